@@ -0,0 +1,56 @@
+package wasabi
+
+import "context"
+
+type attrsContextKey struct{}
+
+// GetAttr returns the connection attribute with the given key converted to type T.
+// It returns zero value of T and false if the attribute is not set or has a different type.
+func GetAttr[T any](conn Connection, key string) (T, bool) {
+	var zero T
+
+	value, ok := conn.Attr(key)
+	if !ok {
+		return zero, false
+	}
+
+	typed, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+
+	return typed, true
+}
+
+// SetAttr sets the connection attribute with the given key to the typed value.
+func SetAttr[T any](conn Connection, key string, value T) {
+	conn.SetAttr(key, value)
+}
+
+// ContextWithAttrs returns a copy of the context with initial connection attributes.
+// It is used during the handshake to populate attributes of the connection that will be created with this context.
+// Attributes that are already present in the context are preserved unless they are overridden by attrs.
+func ContextWithAttrs(ctx context.Context, attrs map[string]any) context.Context {
+	existing := AttrsFromContext(ctx)
+	merged := make(map[string]any, len(existing)+len(attrs))
+
+	for key, value := range existing {
+		merged[key] = value
+	}
+
+	for key, value := range attrs {
+		merged[key] = value
+	}
+
+	return context.WithValue(ctx, attrsContextKey{}, merged)
+}
+
+// AttrsFromContext returns initial connection attributes stored in the context.
+// The returned map must not be modified.
+func AttrsFromContext(ctx context.Context) map[string]any {
+	if attrs, ok := ctx.Value(attrsContextKey{}).(map[string]any); ok {
+		return attrs
+	}
+
+	return nil
+}
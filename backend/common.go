@@ -1,9 +1,21 @@
 package backend
 
 import (
+	"bytes"
+	"io"
 	"net/http"
 
 	"github.com/ksysoev/wasabi"
 )
 
 type RequestFactory func(req wasabi.Request) (*http.Request, error)
+
+// RequestBody returns reader of the request body that can be used as the body of the backend request.
+// For streaming requests, the body is read from the connection as it arrives, without buffering it in memory.
+func RequestBody(req wasabi.Request) io.Reader {
+	if streamReq, ok := req.(wasabi.StreamRequest); ok {
+		return streamReq.Reader()
+	}
+
+	return bytes.NewReader(req.Data())
+}
@@ -1,11 +1,13 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 
+	"github.com/coder/websocket"
 	"github.com/ksysoev/wasabi"
 	"github.com/ksysoev/wasabi/channel"
 )
@@ -65,20 +67,67 @@ func (b *HTTPBackend) Handle(conn wasabi.Connection, r wasabi.Request) error {
 
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
+	return relayBody(conn, resp.Body)
+}
 
-	if err := conn.Send(wasabi.MsgTypeText, body); err != nil {
-		if err == channel.ErrConnectionClosed {
+// relayBody streams the response body to the connection as a single text message without buffering it in memory.
+// If reading the body fails midway, the connection is closed with internal error status instead of sending truncated message.
+func relayBody(conn wasabi.Connection, body io.Reader) error {
+	w, err := conn.Writer(wasabi.MsgTypeText)
+	if err != nil {
+		if errors.Is(err, channel.ErrConnectionClosed) {
 			return nil
 		}
 
 		return err
 	}
 
-	return nil
+	_, copyErr := io.Copy(w, &bodyReader{reader: body})
+
+	var readErr *bodyReadError
+	if errors.As(copyErr, &readErr) {
+		// Closing the writer would deliver the truncated body as a complete message,
+		// so the connection is closed instead and the client never sees it.
+		_ = conn.Close(websocket.StatusInternalError, "Internal Server Error")
+
+		return fmt.Errorf("failed to read response body: %w", readErr.err)
+	}
+
+	closeErr := w.Close()
+
+	err = copyErr
+	if err == nil {
+		err = closeErr
+	}
+
+	if errors.Is(err, channel.ErrConnectionClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// bodyReadError is error of reading the response body, it's used to tell it apart from errors of writing to the connection.
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return e.err.Error()
+}
+
+// bodyReader wraps errors of the response body reader into bodyReadError.
+type bodyReader struct {
+	reader io.Reader
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		return n, &bodyReadError{err: err}
+	}
+
+	return n, err
 }
 
 // WithTimeout sets the default timeout for the HTTP client.
@@ -4,13 +4,19 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/coder/websocket"
 	"github.com/ksysoev/wasabi"
 	"github.com/ksysoev/wasabi/channel"
+	"github.com/ksysoev/wasabi/dispatch"
 	"github.com/ksysoev/wasabi/mocks"
 )
 
@@ -42,7 +48,8 @@ func TestHTTPBackend_Handle(t *testing.T) {
 
 	mockReq.EXPECT().Context().Return(context.Background())
 
-	mockConn.EXPECT().Send(wasabi.MsgTypeText, []byte("OK")).Return(nil)
+	w := &testWriter{}
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(w, nil)
 	mockReq.EXPECT().Data().Return([]byte("test request"))
 
 	backend := NewBackend(func(req wasabi.Request) (*http.Request, error) {
@@ -60,6 +67,10 @@ func TestHTTPBackend_Handle(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	if w.String() != "OK" {
+		t.Errorf("Expected response %q, but got %q", "OK", w.String())
+	}
 }
 
 func TestHTTPBackend_Handle_ErrorCreatingHTTPRequest(t *testing.T) {
@@ -92,7 +103,7 @@ func TestHTTPBackend_Handle_ErrorSendingResponse(t *testing.T) {
 
 	mockReq.EXPECT().Context().Return(context.Background())
 
-	mockConn.EXPECT().Send(wasabi.MsgTypeText, []byte("OK")).Return(expectedError)
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(&testWriter{closeErr: expectedError}, nil)
 	mockReq.EXPECT().Data().Return([]byte("test request"))
 
 	backend := NewBackend(func(req wasabi.Request) (*http.Request, error) {
@@ -123,7 +134,7 @@ func TestHTTPBackend_Handle_ErrorConnectionClosed(t *testing.T) {
 
 	mockReq.EXPECT().Context().Return(context.Background())
 
-	mockConn.EXPECT().Send(wasabi.MsgTypeText, []byte("OK")).Return(channel.ErrConnectionClosed)
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(&testWriter{closeErr: channel.ErrConnectionClosed}, nil)
 	mockReq.EXPECT().Data().Return([]byte("test request"))
 
 	backend := NewBackend(func(req wasabi.Request) (*http.Request, error) {
@@ -204,3 +215,159 @@ func TestWithMaxRequestsPerHost_DefaultValue(t *testing.T) {
 		t.Errorf("Expected MaxConnsPerHost to be %v, but got %v", defaultMaxReqPerHost, tr.MaxConnsPerHost)
 	}
 }
+
+func TestHTTPBackend_Handle_StreamRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, _ = w.Write([]byte(strconv.Itoa(len(body))))
+	}))
+	defer server.Close()
+
+	mockConn := mocks.NewMockConnection(t)
+	w := &testWriter{}
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(w, nil)
+
+	payload := bytes.Repeat([]byte("a"), 1<<20)
+	req := dispatch.NewRawStreamRequest(context.Background(), wasabi.MsgTypeBinary, bytes.NewReader(payload))
+
+	backend := NewBackend(func(req wasabi.Request) (*http.Request, error) {
+		return http.NewRequest("POST", server.URL, RequestBody(req))
+	})
+
+	if err := backend.Handle(mockConn, req); err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+
+	if w.String() != "1048576" {
+		t.Errorf("Expected response %q, but got %q", "1048576", w.String())
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	mockReq := mocks.NewMockRequest(t)
+	mockReq.EXPECT().Data().Return([]byte("buffered"))
+
+	body, err := io.ReadAll(RequestBody(mockReq))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(body) != "buffered" {
+		t.Errorf("Expected body %q, but got %q", "buffered", string(body))
+	}
+
+	streamReq := dispatch.NewRawStreamRequest(context.Background(), wasabi.MsgTypeText, strings.NewReader("streamed"))
+
+	body, err = io.ReadAll(RequestBody(streamReq))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(body) != "streamed" {
+		t.Errorf("Expected body %q, but got %q", "streamed", string(body))
+	}
+}
+
+func TestHTTPBackend_Handle_StreamsResponse(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 1<<20)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	defer server.Close()
+
+	mockConn := mocks.NewMockConnection(t)
+	mockReq := mocks.NewMockRequest(t)
+
+	mockReq.EXPECT().Context().Return(context.Background())
+
+	w := &testWriter{}
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(w, nil)
+
+	backend := NewBackend(func(_ wasabi.Request) (*http.Request, error) {
+		return http.NewRequest("GET", server.URL, http.NoBody)
+	})
+
+	if err := backend.Handle(mockConn, mockReq); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(w.buf.Bytes(), payload) {
+		t.Errorf("Expected %d bytes to be streamed, but got %d", len(payload), w.buf.Len())
+	}
+
+	if w.writes < 2 {
+		t.Errorf("Expected response to be written in several chunks, but got %d", w.writes)
+	}
+
+	if !w.closed {
+		t.Error("Expected writer to be closed")
+	}
+}
+
+func TestHTTPBackend_Handle_WriterConnectionClosed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	mockConn := mocks.NewMockConnection(t)
+	mockReq := mocks.NewMockRequest(t)
+
+	mockReq.EXPECT().Context().Return(context.Background())
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(nil, channel.ErrConnectionClosed)
+
+	backend := NewBackend(func(_ wasabi.Request) (*http.Request, error) {
+		return http.NewRequest("GET", server.URL, http.NoBody)
+	})
+
+	if err := backend.Handle(mockConn, mockReq); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestRelayBody_ReadError(t *testing.T) {
+	readErr := errors.New("read error")
+
+	mockConn := mocks.NewMockConnection(t)
+
+	w := &testWriter{}
+	mockConn.EXPECT().Writer(wasabi.MsgTypeText).Return(w, nil)
+	mockConn.EXPECT().Close(websocket.StatusInternalError, "Internal Server Error").Return(nil)
+
+	err := relayBody(mockConn, io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(readErr)))
+	if !errors.Is(err, readErr) {
+		t.Errorf("Expected error %v, but got %v", readErr, err)
+	}
+
+	if w.closed {
+		t.Error("Expected truncated message not to be completed")
+	}
+}
+
+// testWriter collects the streamed message and returns closeErr on Close.
+type testWriter struct {
+	closeErr error
+	buf      bytes.Buffer
+	writes   int
+	closed   bool
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func (w *testWriter) String() string {
+	return w.buf.String()
+}
+
+func (w *testWriter) Close() error {
+	w.closed = true
+	return w.closeErr
+}
@@ -29,6 +29,11 @@ type request struct {
 //   - id: a string representing the ID of the request.
 //
 // It returns an error if there was an issue handling the request.
+//
+// The payload of the request is valid only until Handle returns, which can happen before the response
+// if the request context is canceled. If the request is published asynchronously,
+// it should be retained with dispatch.RetainRequest and released after publishing,
+// or copied with dispatch.CopyRequest.
 type OnRequestCallback func(conn wasabi.Connection, req wasabi.Request, id string) error
 
 // QueueBackend represents a backend for handling requests in a queue.
@@ -2,29 +2,208 @@ package channel
 
 import (
 	"bytes"
+	"slices"
 	"sync"
+	"sync/atomic"
 )
 
-type bufferPool struct {
-	pool *sync.Pool
+const (
+	defaultMaxBufferSize    = 1024 * 1024
+	defaultMaxRetainedBytes = 64 * 1024 * 1024
+)
+
+// defaultSizeClasses are capacities of buffers in the default buffer pool.
+var defaultSizeClasses = []int{1024, 4096, 16384, 65536, 262144, 1048576}
+
+// BufferPool is interface for pools of buffers that are used to read incoming messages.
+// Get returns a buffer for a message of the expected size, the size is 0 if it's unknown.
+// Put returns the buffer to the pool after the message is processed.
+type BufferPool interface {
+	Get(size int) *bytes.Buffer
+	Put(b *bytes.Buffer)
+}
+
+// BufferPoolStats is a snapshot of buffer pool statistics.
+type BufferPoolStats struct {
+	// Hits is number of buffers that were reused from the pool.
+	Hits uint64
+	// Misses is number of buffers that were allocated because there was no buffer of the required size in the pool.
+	Misses uint64
+	// Dropped is number of buffers that were not retained because they are too large or the pool is full.
+	Dropped uint64
+	// RetainedBytes is total capacity of buffers that are currently kept in the pool.
+	RetainedBytes int64
+	// RetainedBuffers is number of buffers that are currently kept in the pool.
+	RetainedBuffers int64
+}
+
+// BufferPoolOption is a function type that configures SizeClassBufferPool.
+type BufferPoolOption func(*SizeClassBufferPool)
+
+// sizeClass is a stack of buffers with capacity of at least size bytes.
+type sizeClass struct {
+	buffers []*bytes.Buffer
+	size    int
+	mu      sync.Mutex
 }
 
-func newBufferPool() *bufferPool {
-	return &bufferPool{
-		pool: &sync.Pool{
-			New: func() interface{} {
-				return &bytes.Buffer{}
-			},
-		},
+// SizeClassBufferPool is a buffer pool that keeps buffers in size classes,
+// so a buffer that grew while reading a large message is not handed out for small messages.
+// Buffers larger than the maximum buffer size are never retained,
+// and the total capacity of retained buffers is limited by the maximum retained bytes.
+type SizeClassBufferPool struct {
+	classes          []*sizeClass
+	hits             atomic.Uint64
+	misses           atomic.Uint64
+	dropped          atomic.Uint64
+	retainedBytes    atomic.Int64
+	retainedBuffers  atomic.Int64
+	maxBufferSize    int
+	maxRetainedBytes int64
+}
+
+// NewSizeClassBufferPool creates new instance of SizeClassBufferPool
+// By default, buffers are kept in size classes from 1KB to 1MB,
+// buffers larger than 1MB are dropped, and the pool retains up to 64MB of buffers.
+func NewSizeClassBufferPool(opts ...BufferPoolOption) *SizeClassBufferPool {
+	p := &SizeClassBufferPool{
+		maxBufferSize:    defaultMaxBufferSize,
+		maxRetainedBytes: defaultMaxRetainedBytes,
+	}
+
+	for _, size := range defaultSizeClasses {
+		p.classes = append(p.classes, &sizeClass{size: size})
 	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
 }
 
-func (p *bufferPool) get() *bytes.Buffer {
-	b, _ := p.pool.Get().(*bytes.Buffer)
+// Get returns a buffer from the size class that fits the expected size.
+// If there is no buffer in the class, a new one is allocated with the capacity of the class.
+func (p *SizeClassBufferPool) Get(size int) *bytes.Buffer {
+	class := p.classFor(size)
+	if class == nil {
+		p.misses.Add(1)
+		return &bytes.Buffer{}
+	}
+
+	class.mu.Lock()
+
+	if n := len(class.buffers); n > 0 {
+		b := class.buffers[n-1]
+		class.buffers[n-1] = nil
+		class.buffers = class.buffers[:n-1]
+		class.mu.Unlock()
+
+		p.hits.Add(1)
+		p.retainedBytes.Add(-int64(b.Cap()))
+		p.retainedBuffers.Add(-1)
+
+		return b
+	}
+
+	class.mu.Unlock()
+
+	p.misses.Add(1)
+
+	b := &bytes.Buffer{}
+	b.Grow(class.size)
+
 	return b
 }
 
-func (p *bufferPool) put(b *bytes.Buffer) {
+// Put resets the buffer and returns it to the largest size class it can serve.
+// The buffer is dropped if it's larger than the maximum buffer size or the pool retains too many bytes already.
+func (p *SizeClassBufferPool) Put(b *bytes.Buffer) {
 	b.Reset()
-	p.pool.Put(b)
+
+	capacity := b.Cap()
+
+	if capacity > p.maxBufferSize || len(p.classes) == 0 {
+		p.dropped.Add(1)
+		return
+	}
+
+	if p.retainedBytes.Add(int64(capacity)) > p.maxRetainedBytes {
+		p.retainedBytes.Add(-int64(capacity))
+		p.dropped.Add(1)
+
+		return
+	}
+
+	class := p.classes[0]
+
+	for _, c := range p.classes[1:] {
+		if c.size > capacity {
+			break
+		}
+
+		class = c
+	}
+
+	class.mu.Lock()
+	class.buffers = append(class.buffers, b)
+	class.mu.Unlock()
+
+	p.retainedBuffers.Add(1)
+}
+
+// Stats returns a snapshot of the pool statistics.
+func (p *SizeClassBufferPool) Stats() BufferPoolStats {
+	return BufferPoolStats{
+		Hits:            p.hits.Load(),
+		Misses:          p.misses.Load(),
+		Dropped:         p.dropped.Load(),
+		RetainedBytes:   p.retainedBytes.Load(),
+		RetainedBuffers: p.retainedBuffers.Load(),
+	}
+}
+
+// classFor returns the smallest size class that fits the size,
+// or nil if the size is larger than the largest class or the maximum buffer size.
+func (p *SizeClassBufferPool) classFor(size int) *sizeClass {
+	if size > p.maxBufferSize {
+		return nil
+	}
+
+	for _, class := range p.classes {
+		if class.size >= size {
+			return class
+		}
+	}
+
+	return nil
+}
+
+// WithSizeClasses sets capacities of buffers for size classes of the pool.
+func WithSizeClasses(sizes ...int) BufferPoolOption {
+	return func(p *SizeClassBufferPool) {
+		sizes = slices.Clone(sizes)
+		slices.Sort(sizes)
+
+		p.classes = make([]*sizeClass, 0, len(sizes))
+
+		for _, size := range slices.Compact(sizes) {
+			p.classes = append(p.classes, &sizeClass{size: size})
+		}
+	}
+}
+
+// WithMaxBufferSize sets the maximum capacity of a buffer that is retained in the pool,
+// larger buffers are dropped and left to the garbage collector.
+func WithMaxBufferSize(size int) BufferPoolOption {
+	return func(p *SizeClassBufferPool) {
+		p.maxBufferSize = size
+	}
+}
+
+// WithMaxRetainedBytes sets the maximum total capacity of buffers retained in the pool.
+func WithMaxRetainedBytes(size int64) BufferPoolOption {
+	return func(p *SizeClassBufferPool) {
+		p.maxRetainedBytes = size
+	}
 }
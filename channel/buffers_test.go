@@ -0,0 +1,120 @@
+package channel
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestSizeClassBufferPool_GetPut(t *testing.T) {
+	pool := NewSizeClassBufferPool(WithSizeClasses(1024, 4096))
+
+	b := pool.Get(0)
+	if b.Cap() < 1024 {
+		t.Errorf("Expected buffer with capacity of the smallest class, but got %d", b.Cap())
+	}
+
+	b.WriteString("test")
+	pool.Put(b)
+
+	if b.Len() != 0 {
+		t.Error("Expected buffer to be reset when it's returned to the pool")
+	}
+
+	if reused := pool.Get(100); reused != b {
+		t.Error("Expected buffer to be reused from the pool")
+	}
+
+	stats := pool.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats: got %d hits and %d misses, expected 1 and 1", stats.Hits, stats.Misses)
+	}
+
+	if stats.RetainedBytes != 0 || stats.RetainedBuffers != 0 {
+		t.Errorf("Expected no retained buffers, but got %d buffers with %d bytes", stats.RetainedBuffers, stats.RetainedBytes)
+	}
+}
+
+func TestSizeClassBufferPool_SizeClasses(t *testing.T) {
+	pool := NewSizeClassBufferPool(WithSizeClasses(4096, 1024))
+
+	large := &bytes.Buffer{}
+	large.Grow(8192)
+	pool.Put(large)
+
+	// The large buffer is not handed out for small messages
+	if small := pool.Get(10); small == large {
+		t.Error("Expected large buffer not to be used for small message")
+	}
+
+	if b := pool.Get(3000); b != large {
+		t.Error("Expected large buffer to be used for message that fits its size class")
+	}
+}
+
+func TestSizeClassBufferPool_MaxBufferSize(t *testing.T) {
+	pool := NewSizeClassBufferPool(WithMaxBufferSize(2048))
+
+	huge := &bytes.Buffer{}
+	huge.Grow(10 * 1024 * 1024)
+	pool.Put(huge)
+
+	stats := pool.Stats()
+	if stats.Dropped != 1 {
+		t.Errorf("Expected huge buffer to be dropped, but got %d dropped", stats.Dropped)
+	}
+
+	if stats.RetainedBytes != 0 {
+		t.Errorf("Expected no retained bytes, but got %d", stats.RetainedBytes)
+	}
+
+	if b := pool.Get(5000); b.Cap() != 0 {
+		t.Errorf("Expected buffer larger than max buffer size to be allocated on demand, but got capacity %d", b.Cap())
+	}
+}
+
+func TestSizeClassBufferPool_MaxRetainedBytes(t *testing.T) {
+	pool := NewSizeClassBufferPool(WithSizeClasses(1024), WithMaxRetainedBytes(2048))
+
+	buffers := []*bytes.Buffer{pool.Get(0), pool.Get(0), pool.Get(0)}
+
+	for _, b := range buffers {
+		pool.Put(b)
+	}
+
+	stats := pool.Stats()
+	if stats.RetainedBuffers != 2 || stats.RetainedBytes != 2048 {
+		t.Errorf("Expected 2 buffers with 2048 bytes to be retained, but got %d buffers with %d bytes", stats.RetainedBuffers, stats.RetainedBytes)
+	}
+
+	if stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped buffer, but got %d", stats.Dropped)
+	}
+}
+
+func TestSizeClassBufferPool_Concurrent(t *testing.T) {
+	pool := NewSizeClassBufferPool()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				b := pool.Get(j * 100)
+				b.Write(make([]byte, j*100))
+				pool.Put(b)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	stats := pool.Stats()
+	if stats.Hits+stats.Misses != 1000 {
+		t.Errorf("Expected 1000 buffers to be requested, but got %d", stats.Hits+stats.Misses)
+	}
+}
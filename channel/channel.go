@@ -3,6 +3,8 @@ package channel
 import (
 	"context"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/coder/websocket"
 	"github.com/ksysoev/wasabi"
@@ -18,9 +20,14 @@ type Channel struct {
 }
 
 type channelConfig struct {
+	subprotocols         map[string]wasabi.Dispatcher
+	onUpgrade            UpgradeHook
+	originChecker        OriginChecker
 	originPatterns       []string
+	subprotocolNames     []string
 	compressionMode      websocket.CompressionMode
 	compressionThreshold int
+	rejectUnknownProtos  bool
 }
 
 type Option func(*channelConfig)
@@ -41,6 +48,7 @@ func NewChannel(
 		originPatterns:       []string{"*"},
 		compressionMode:      websocket.CompressionDisabled,
 		compressionThreshold: 0,
+		subprotocols:         make(map[string]wasabi.Dispatcher),
 	}
 
 	for _, opt := range opts {
@@ -69,15 +77,40 @@ func (c *Channel) Handler() http.Handler {
 // wsConnectionHandler handles the WebSocket connection and sets up the necessary components for communication.
 func (c *Channel) wsConnectionHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-
 		if !c.connRegistry.CanAccept() {
 			http.Error(w, "Connection limit reached", http.StatusServiceUnavailable)
 			return
 		}
 
+		if !c.checkOrigin(w, r) {
+			return
+		}
+
+		if c.config.rejectUnknownProtos && !c.hasKnownSubprotocol(r) {
+			http.Error(w, "Unsupported subprotocol", http.StatusBadRequest)
+			return
+		}
+
+		r, override, ok := c.upgrade(w, r)
+		if !ok {
+			return
+		}
+
+		if acceptor, ok := c.connRegistry.(RequestAcceptor); ok {
+			var status int
+
+			if r, status = acceptor.AcceptRequest(r); status != 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+		}
+
+		ctx := r.Context()
+
+		// Origin is already checked by the channel, so the check of the websocket library is skipped.
 		ws, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-			OriginPatterns:       c.config.originPatterns,
+			Subprotocols:         c.config.subprotocolNames,
+			InsecureSkipVerify:   true,
 			CompressionMode:      c.config.compressionMode,
 			CompressionThreshold: c.config.compressionThreshold,
 		})
@@ -85,10 +118,66 @@ func (c *Channel) wsConnectionHandler() http.Handler {
 			return
 		}
 
-		c.connRegistry.HandleConnection(ctx, ws, c.disptacher.Dispatch)
+		ctx = withResumeRequest(ctx, r)
+
+		dispatcher := override
+		if dispatcher == nil {
+			dispatcher = c.dispatcherFor(ws.Subprotocol())
+		}
+
+		if streamDispatcher, ok := dispatcher.(wasabi.StreamDispatcher); ok {
+			if registry, ok := c.connRegistry.(wasabi.StreamConnectionRegistry); ok {
+				registry.HandleStreamConnection(ctx, ws, streamDispatcher.DispatchStream)
+				return
+			}
+		}
+
+		c.connRegistry.HandleConnection(ctx, ws, dispatcher.Dispatch)
 	})
 }
 
+// dispatcherFor returns dispatcher registered for the negotiated subprotocol,
+// or the default dispatcher of the channel if no subprotocol was negotiated.
+func (c *Channel) dispatcherFor(subprotocol string) wasabi.Dispatcher {
+	if dispatcher, ok := c.config.subprotocols[subprotocol]; ok {
+		return dispatcher
+	}
+
+	return c.disptacher
+}
+
+// hasKnownSubprotocol checks if the handshake request either doesn't ask for any subprotocol
+// or asks for at least one subprotocol registered in the channel.
+func (c *Channel) hasKnownSubprotocol(r *http.Request) bool {
+	offered := requestedSubprotocols(r)
+	if len(offered) == 0 {
+		return true
+	}
+
+	for _, name := range offered {
+		if _, ok := c.config.subprotocols[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requestedSubprotocols returns list of subprotocols from Sec-WebSocket-Protocol headers of the request.
+func requestedSubprotocols(r *http.Request) []string {
+	protocols := make([]string, 0)
+
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, name := range strings.Split(header, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				protocols = append(protocols, name)
+			}
+		}
+	}
+
+	return protocols
+}
+
 // Use adds middlewere to channel
 func (c *Channel) Use(middlewere Middlewere) {
 	c.middlewares = append(c.middlewares, middlewere)
@@ -112,7 +201,8 @@ func (c *Channel) wrapMiddleware(handler http.Handler) http.Handler {
 
 // WithOriginPatterns sets the origin patterns for the channel.
 // The origin patterns are used to validate the Origin header of the WebSocket handshake request.
-// If the Origin header does not match any of the patterns, the connection is rejected.
+// If the Origin header does not match any of the patterns, the connection is rejected with status 403 (forbidden).
+// Patterns are fixed, for patterns that change at runtime use WithOriginChecker with OriginAllowList.
 func WithOriginPatterns(patterns ...string) Option {
 	return func(c *channelConfig) {
 		c.originPatterns = patterns
@@ -128,3 +218,28 @@ func WithCompressionMode(mode websocket.CompressionMode, threshold int) Option {
 		c.compressionThreshold = threshold
 	}
 }
+
+// WithSubprotocol registers the dispatcher for the WebSocket subprotocol.
+// During the handshake, the channel negotiates the subprotocol with the client using Sec-WebSocket-Protocol header,
+// and messages of the connection are dispatched with the dispatcher of the negotiated subprotocol.
+// Subprotocols are preferred in the order they are registered.
+// The negotiated subprotocol is available to handlers as the AttrSubprotocol connection attribute.
+// If the client doesn't ask for any known subprotocol, the default dispatcher of the channel is used.
+func WithSubprotocol(name string, dispatcher wasabi.Dispatcher) Option {
+	return func(c *channelConfig) {
+		if !slices.Contains(c.subprotocolNames, name) {
+			c.subprotocolNames = append(c.subprotocolNames, name)
+		}
+
+		c.subprotocols[name] = dispatcher
+	}
+}
+
+// WithRejectUnknownSubprotocols makes the channel reject handshake requests with status 400 (bad request)
+// if the client asks only for subprotocols that are not registered with WithSubprotocol.
+// Requests without Sec-WebSocket-Protocol header are still accepted and use the default dispatcher.
+func WithRejectUnknownSubprotocols() Option {
+	return func(c *channelConfig) {
+		c.rejectUnknownProtos = true
+	}
+}
@@ -2,12 +2,19 @@ package channel
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	whttp "github.com/ksysoev/wasabi/middleware/http"
 	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestNewChannel(t *testing.T) {
@@ -232,3 +239,201 @@ func TestChannel_WithCompressionMode(t *testing.T) {
 		t.Errorf("Unexpected compression threshold: got %d, expected %d", channel.config.compressionThreshold, compressionThreshold)
 	}
 }
+
+func TestChannel_WithSubprotocol(t *testing.T) {
+	defaultDispatcher := mocks.NewMockDispatcher(t)
+	v1Dispatcher := mocks.NewMockDispatcher(t)
+	v2Dispatcher := mocks.NewMockDispatcher(t)
+
+	received := make(chan string, 1)
+
+	v2Dispatcher.EXPECT().Dispatch(mock.Anything, wasabi.MsgTypeText, []byte("hello")).Run(func(conn wasabi.Connection, _ wasabi.MessageType, _ []byte) {
+		c, ok := conn.(*Conn)
+		if !ok {
+			t.Errorf("Expected connection to be *Conn, but got %T", conn)
+			return
+		}
+
+		// Handlers that get wrapped connections read the subprotocol from the attribute.
+		wrapped := NewConnectionWrapper(conn)
+
+		if proto, _ := wasabi.GetAttr[string](wrapped, AttrSubprotocol); proto != c.Subprotocol() {
+			t.Errorf("Unexpected subprotocol attribute: got %q, expected %q", proto, c.Subprotocol())
+		}
+
+		received <- c.Subprotocol()
+	})
+
+	registry := NewConnectionRegistry()
+	channel := NewChannel("/", defaultDispatcher, registry,
+		WithSubprotocol("v1.json", v1Dispatcher),
+		WithSubprotocol("v2.msgpack", v2Dispatcher),
+	)
+
+	if len(channel.config.subprotocolNames) != 2 {
+		t.Errorf("Unexpected number of subprotocols: got %d, expected %d", len(channel.config.subprotocolNames), 2)
+	}
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), &websocket.DialOptions{
+		Subprotocols: []string{"v3.proto", "v2.msgpack"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	if ws.Subprotocol() != "v2.msgpack" {
+		t.Errorf("Unexpected negotiated subprotocol: got %q, expected %q", ws.Subprotocol(), "v2.msgpack")
+	}
+
+	if err := ws.Write(context.Background(), websocket.MessageText, []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error writing to websocket: %v", err)
+	}
+
+	select {
+	case proto := <-received:
+		if proto != "v2.msgpack" {
+			t.Errorf("Unexpected connection subprotocol: got %q, expected %q", proto, "v2.msgpack")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected message to be dispatched with subprotocol dispatcher")
+	}
+
+	// The mock keeps the connection as a call argument, so it must be closed before the mock is asserted
+	_ = ws.CloseNow()
+
+	assert.Eventually(t, func() bool { return registry.Count() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestChannel_WithRejectUnknownSubprotocols(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	connRegistry := mocks.NewMockConnectionRegistry(t)
+	connRegistry.EXPECT().CanAccept().Return(true)
+
+	channel := NewChannel("/", dispatcher, connRegistry,
+		WithSubprotocol("v1.json", dispatcher),
+		WithRejectUnknownSubprotocols(),
+	)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{name: "unknown subprotocol", header: "v3.proto, v4.proto", expected: http.StatusBadRequest},
+		{name: "known subprotocol", header: "v3.proto, v1.json", expected: http.StatusUpgradeRequired},
+		{name: "no subprotocol", header: "", expected: http.StatusUpgradeRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+			if tt.header != "" {
+				req.Header.Set("Sec-WebSocket-Protocol", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			channel.wsConnectionHandler().ServeHTTP(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.expected {
+				t.Errorf("Unexpected status code: got %d, expected %d", res.StatusCode, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChannel_wsConnectionHandler_KeyLimitReached(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	registry := NewConnectionRegistry(WithConnectionLimitPerKey(1, ClientIPKey))
+	registry.keyLimiter.acquire("192.0.2.1")
+
+	channel := NewChannel("/", dispatcher, registry)
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	w := httptest.NewRecorder()
+
+	channel.Use(whttp.NewClientIPMiddleware(whttp.NotProvided))
+	channel.Handler().ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Unexpected status code: got %d, expected %d", res.StatusCode, http.StatusTooManyRequests)
+	}
+
+	// Other clients are not affected
+	req = httptest.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+	req.RemoteAddr = "192.0.2.2:1234"
+
+	w = httptest.NewRecorder()
+	channel.Handler().ServeHTTP(w, req)
+
+	res = w.Result()
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Unexpected status code: got %d, expected %d", res.StatusCode, http.StatusUpgradeRequired)
+	}
+}
+
+type testStreamDispatcher struct {
+	*mocks.MockDispatcher
+	received chan string
+}
+
+func (d *testStreamDispatcher) DispatchStream(_ wasabi.Connection, _ wasabi.MessageType, r io.Reader) {
+	data, _ := io.ReadAll(r)
+	d.received <- string(data)
+}
+
+func TestChannel_StreamDispatcher(t *testing.T) {
+	dispatcher := &testStreamDispatcher{
+		MockDispatcher: mocks.NewMockDispatcher(t),
+		received:       make(chan string, 1),
+	}
+
+	channel := NewChannel("/", dispatcher, NewConnectionRegistry(WithMaxFrameLimit(16), WithStreamReadLimit(1024)))
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	message := strings.Repeat("b", 512)
+
+	if err := ws.Write(context.Background(), websocket.MessageText, []byte(message)); err != nil {
+		t.Fatalf("Unexpected error writing to websocket: %v", err)
+	}
+
+	select {
+	case data := <-dispatcher.received:
+		if data != message {
+			t.Errorf("Unexpected streamed message: got %d bytes, expected %d bytes", len(data), len(message))
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected message to be dispatched as stream")
+	}
+}
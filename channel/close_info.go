@@ -0,0 +1,73 @@
+package channel
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+var (
+	// ErrInactivityTimeout is the close error of connections closed by the inactivity timeout.
+	ErrInactivityTimeout = errors.New("inactivity timeout")
+	// ErrHeartbeatTimeout is the close error of connections terminated because the client missed heartbeat pongs.
+	ErrHeartbeatTimeout = errors.New("heartbeat timeout")
+	// ErrRateLimitExceeded is the close error of connections closed for exceeding inbound rate limits.
+	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+	// ErrSendQueueOverflow is the close error of connections closed because their send queue overflowed.
+	ErrSendQueueOverflow = errors.New("send queue overflow")
+	// ErrReadIdleTimeout is the close error of connections that didn't receive messages within the read idle timeout.
+	ErrReadIdleTimeout = errors.New("read idle timeout")
+	// ErrWriteIdleTimeout is the close error of connections that didn't send messages within the write idle timeout.
+	ErrWriteIdleTimeout = errors.New("write idle timeout")
+	// ErrMaxLifetimeReached is the close error of connections closed after reaching their maximum lifetime.
+	ErrMaxLifetimeReached = errors.New("max connection lifetime reached")
+)
+
+// recordCloseInfo stores the close info if no close info is stored yet, so the first cause of the close wins.
+// It returns the stored close info.
+func recordCloseInfo(p *atomic.Pointer[wasabi.CloseInfo], info *wasabi.CloseInfo) *wasabi.CloseInfo {
+	if p.CompareAndSwap(nil, info) {
+		return info
+	}
+
+	return p.Load()
+}
+
+// serverClose returns the close info for the close initiated by the server.
+func serverClose(status websocket.StatusCode, reason string, err error) *wasabi.CloseInfo {
+	return &wasabi.CloseInfo{
+		Code:      status,
+		Reason:    reason,
+		Err:       err,
+		Initiator: wasabi.ClosedByServer,
+	}
+}
+
+// clientGone returns the close info for the connection that was closed or lost by the client.
+func clientGone(status websocket.StatusCode, err error) *wasabi.CloseInfo {
+	return &wasabi.CloseInfo{
+		Code:      status,
+		Err:       err,
+		Initiator: wasabi.ClosedByClient,
+	}
+}
+
+// readCloseInfo returns the close info for the error that stopped reading of the websocket connection.
+func readCloseInfo(err error) *wasabi.CloseInfo {
+	var closeErr websocket.CloseError
+
+	switch {
+	case errors.As(err, &closeErr):
+		return &wasabi.CloseInfo{
+			Code:      closeErr.Code,
+			Reason:    closeErr.Reason,
+			Initiator: wasabi.ClosedByClient,
+		}
+	case errors.Is(err, websocket.ErrMessageTooBig):
+		return serverClose(websocket.StatusMessageTooBig, "message too big", err)
+	default:
+		return clientGone(websocket.StatusAbnormalClosure, err)
+	}
+}
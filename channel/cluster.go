@@ -0,0 +1,256 @@
+package channel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ksysoev/wasabi"
+)
+
+const (
+	// clusterNodeSeparator separates the node id from the rest of ids of connections created in cluster mode.
+	clusterNodeSeparator = ":"
+	// clusterBroadcastSubject is the bus subject that every node of the cluster is subscribed to.
+	clusterBroadcastSubject = "wasabi.broadcast"
+	// clusterNodeSubjectPrefix is the prefix of bus subjects of individual nodes.
+	clusterNodeSubjectPrefix = "wasabi.node."
+)
+
+var (
+	// ErrInvalidNodeID is error for node ids that are empty or contain the node separator
+	ErrInvalidNodeID = errors.New("invalid cluster node id")
+	// ErrAlreadyInCluster is error for registries that join a cluster more than once
+	ErrAlreadyInCluster = errors.New("connection registry already joined a cluster")
+	// ErrInvalidClusterMessage is error for malformed messages received from the message bus
+	ErrInvalidClusterMessage = errors.New("invalid cluster message")
+)
+
+// clusterMessageKind defines what the node does with a message received from the message bus.
+type clusterMessageKind uint8
+
+const (
+	// clusterSend delivers the message to the connection with the target id.
+	clusterSend clusterMessageKind = iota + 1
+	// clusterPublish delivers the message to local subscribers of the target topic.
+	clusterPublish
+)
+
+// clusterMessage is a message exchanged by nodes of the cluster.
+type clusterMessage struct {
+	node    string
+	target  string
+	data    []byte
+	kind    clusterMessageKind
+	msgType wasabi.MessageType
+}
+
+// marshal encodes the message as kind and message type bytes, followed by length-prefixed node and target,
+// and the data till the end.
+func (m *clusterMessage) marshal() []byte {
+	buf := make([]byte, 0, 2+2*binary.MaxVarintLen64+len(m.node)+len(m.target)+len(m.data))
+
+	buf = append(buf, byte(m.kind), byte(m.msgType))
+	buf = binary.AppendUvarint(buf, uint64(len(m.node)))
+	buf = append(buf, m.node...)
+	buf = binary.AppendUvarint(buf, uint64(len(m.target)))
+	buf = append(buf, m.target...)
+
+	return append(buf, m.data...)
+}
+
+// unmarshalClusterMessage decodes the message encoded with marshal.
+func unmarshalClusterMessage(data []byte) (*clusterMessage, error) {
+	if len(data) < 2 {
+		return nil, ErrInvalidClusterMessage
+	}
+
+	m := &clusterMessage{
+		kind:    clusterMessageKind(data[0]),
+		msgType: wasabi.MessageType(data[1]),
+	}
+
+	if m.kind != clusterSend && m.kind != clusterPublish {
+		return nil, ErrInvalidClusterMessage
+	}
+
+	var ok bool
+
+	rest := data[2:]
+
+	if m.node, rest, ok = readClusterString(rest); !ok {
+		return nil, ErrInvalidClusterMessage
+	}
+
+	if m.target, rest, ok = readClusterString(rest); !ok {
+		return nil, ErrInvalidClusterMessage
+	}
+
+	m.data = rest
+
+	return m, nil
+}
+
+// readClusterString reads length-prefixed string, it returns the string and the rest of the data.
+func readClusterString(data []byte) (string, []byte, bool) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)-size) {
+		return "", nil, false
+	}
+
+	end := size + int(n)
+
+	return string(data[size:end]), data[end:], true
+}
+
+// clusterMembership is the membership of the registry in the cluster.
+type clusterMembership struct {
+	bus         wasabi.MessageBus
+	nodeID      string
+	unsubscribe []func()
+}
+
+// leave removes subscriptions of the node from the message bus.
+func (c *clusterMembership) leave() {
+	for _, unsubscribe := range c.unsubscribe {
+		unsubscribe()
+	}
+}
+
+// clusterNodeSubject returns the bus subject of the node.
+func clusterNodeSubject(nodeID string) string {
+	return clusterNodeSubjectPrefix + nodeID
+}
+
+// connectionNode returns the node id from the connection id,
+// or empty string if the connection was not created in cluster mode.
+func connectionNode(id string) string {
+	node, _, ok := strings.Cut(id, clusterNodeSeparator)
+	if !ok {
+		return ""
+	}
+
+	return node
+}
+
+// JoinCluster connects the registry to other nodes of the cluster through the message bus,
+// so messages can be sent with SendTo to connections of any node, and Publish delivers messages
+// to subscribers on all nodes. Every node must have unique id, it must not contain ":".
+// In cluster mode ids of new connections are prefixed with the node id and ":",
+// so messages for them are routed to their node directly, messages for other connections
+// are broadcast to all nodes. JoinCluster must be called before the registry starts accepting connections.
+// The registry leaves the cluster when it's closed.
+func (r *ConnectionRegistry) JoinCluster(nodeID string, bus wasabi.MessageBus) error {
+	if nodeID == "" || strings.Contains(nodeID, clusterNodeSeparator) {
+		return ErrInvalidNodeID
+	}
+
+	c := &clusterMembership{
+		bus:    bus,
+		nodeID: nodeID,
+	}
+
+	if !r.cluster.CompareAndSwap(nil, c) {
+		return ErrAlreadyInCluster
+	}
+
+	for _, subject := range []string{clusterNodeSubject(nodeID), clusterBroadcastSubject} {
+		unsubscribe, err := bus.Subscribe(subject, r.handleClusterMessage)
+		if err != nil {
+			c.leave()
+			r.cluster.Store(nil)
+
+			return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+
+		c.unsubscribe = append(c.unsubscribe, unsubscribe)
+	}
+
+	return nil
+}
+
+// NodeID returns id of the cluster node of the registry, or empty string if the registry is not in a cluster.
+func (r *ConnectionRegistry) NodeID() string {
+	if c := r.cluster.Load(); c != nil {
+		return c.nodeID
+	}
+
+	return ""
+}
+
+// SendTo sends message to the connection with the given id, the connection can be connected to any node of the cluster.
+// Messages for connections of this node are sent directly and errors of the connection are returned.
+// Messages for other connections are published to the message bus and only errors of the bus are returned,
+// the message is dropped if the connection is gone by the time it reaches its node.
+// It returns ErrConnectionNotFound if the connection is not found on this node and the registry is not in a cluster.
+func (r *ConnectionRegistry) SendTo(ctx context.Context, id string, msgType wasabi.MessageType, msg []byte) error {
+	if conn := r.GetConnection(id); conn != nil {
+		return conn.Send(msgType, msg)
+	}
+
+	c := r.cluster.Load()
+	if c == nil {
+		return ErrConnectionNotFound
+	}
+
+	subject := clusterBroadcastSubject
+
+	if node := connectionNode(id); node != "" {
+		if node == c.nodeID {
+			return ErrConnectionNotFound
+		}
+
+		subject = clusterNodeSubject(node)
+	}
+
+	m := &clusterMessage{
+		kind:    clusterSend,
+		node:    c.nodeID,
+		target:  id,
+		msgType: msgType,
+		data:    msg,
+	}
+
+	return c.bus.Publish(ctx, subject, m.marshal())
+}
+
+// publishCluster publishes message for the topic subscribers of other nodes.
+func (r *ConnectionRegistry) publishCluster(c *clusterMembership, topic string, msgType wasabi.MessageType, msg []byte) {
+	m := &clusterMessage{
+		kind:    clusterPublish,
+		node:    c.nodeID,
+		target:  topic,
+		msgType: msgType,
+		data:    msg,
+	}
+
+	if err := c.bus.Publish(context.Background(), clusterBroadcastSubject, m.marshal()); err != nil {
+		slog.Error("Failed to publish message to cluster", slog.String("topic", topic), slog.Any("error", err))
+	}
+}
+
+// handleClusterMessage delivers message received from the message bus to local connections.
+func (r *ConnectionRegistry) handleClusterMessage(data []byte) {
+	m, err := unmarshalClusterMessage(data)
+	if err != nil {
+		slog.Warn("Dropped cluster message", slog.Any("error", err))
+		return
+	}
+
+	// Messages of this node are delivered to local connections before they are published.
+	if m.node == r.NodeID() {
+		return
+	}
+
+	switch m.kind {
+	case clusterSend:
+		if conn := r.GetConnection(m.target); conn != nil {
+			_ = conn.Send(m.msgType, m.data)
+		}
+	case clusterPublish:
+		r.publishLocal(m.target, m.msgType, m.data)
+	}
+}
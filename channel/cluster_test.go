@@ -0,0 +1,263 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// clusterConnection returns mock connection with the given id that can be registered in the registry.
+func clusterConnection(t *testing.T, id string) *mocks.MockConnection {
+	t.Helper()
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().ID().Return(id)
+	conn.EXPECT().Context().Return(context.Background()).Maybe()
+
+	return conn
+}
+
+func TestClusterMessage_Marshal(t *testing.T) {
+	m := &clusterMessage{
+		kind:    clusterSend,
+		node:    "node1",
+		target:  "node2:conn",
+		msgType: wasabi.MsgTypeBinary,
+		data:    []byte("hello"),
+	}
+
+	got, err := unmarshalClusterMessage(m.marshal())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got.kind != m.kind || got.node != m.node || got.target != m.target || got.msgType != m.msgType || string(got.data) != "hello" {
+		t.Errorf("Unexpected message: got %+v, expected %+v", got, m)
+	}
+
+	for _, data := range [][]byte{
+		nil,
+		{byte(clusterSend)},
+		{0, byte(wasabi.MsgTypeText), 0, 0},
+		{byte(clusterSend), byte(wasabi.MsgTypeText), 5, 'a'},
+		{byte(clusterPublish), byte(wasabi.MsgTypeText), 1, 'a', 3, 'b'},
+	} {
+		if _, err := unmarshalClusterMessage(data); !errors.Is(err, ErrInvalidClusterMessage) {
+			t.Errorf("Expected error %v for %v, but got %v", ErrInvalidClusterMessage, data, err)
+		}
+	}
+}
+
+func TestConnectionRegistry_JoinCluster(t *testing.T) {
+	bus := NewMemoryBus()
+	connected := make(chan string, 1)
+	registry := NewConnectionRegistry(WithOnConnectHook(func(conn wasabi.Connection) { connected <- conn.ID() }))
+
+	for _, nodeID := range []string{"", "node:1"} {
+		if err := registry.JoinCluster(nodeID, bus); !errors.Is(err, ErrInvalidNodeID) {
+			t.Errorf("Expected error %v for node id %q, but got %v", ErrInvalidNodeID, nodeID, err)
+		}
+	}
+
+	if registry.NodeID() != "" {
+		t.Errorf("Expected empty node id, but got %q", registry.NodeID())
+	}
+
+	if err := registry.JoinCluster("node1", bus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if registry.NodeID() != "node1" {
+		t.Errorf("Unexpected node id: got %q, expected %q", registry.NodeID(), "node1")
+	}
+
+	if err := registry.JoinCluster("node2", bus); !errors.Is(err, ErrAlreadyInCluster) {
+		t.Errorf("Expected error %v, but got %v", ErrAlreadyInCluster, err)
+	}
+
+	if id := registry.NewConnectionID(); !strings.HasPrefix(id, "node1:") {
+		t.Errorf("Expected connection id to be prefixed with node id, but got %q", id)
+	}
+
+	// Connections created by channels get ids from the registry
+	wsServer := httptest.NewServer(NewChannel("/", mocks.NewMockDispatcher(t), registry).Handler())
+	defer wsServer.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+wsServer.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	if id := <-connected; !strings.HasPrefix(id, "node1:") {
+		t.Errorf("Expected websocket connection id to be prefixed with node id, but got %q", id)
+	}
+
+	_ = ws.Close(websocket.StatusNormalClosure, "")
+
+	sseServer := httptest.NewServer(NewSSEChannel("/", mocks.NewMockDispatcher(t), registry).Handler())
+	defer sseServer.Close()
+
+	sseResp, _, sseConn := openSSEStream(t, sseServer.URL)
+	defer sseResp.Body.Close()
+
+	<-connected
+
+	if !strings.HasPrefix(sseConn.ID, "node1:") {
+		t.Errorf("Expected SSE connection id to be prefixed with node id, but got %q", sseConn.ID)
+	}
+
+	if err := registry.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if registry.NodeID() != "" {
+		t.Error("Expected registry to leave the cluster when it's closed")
+	}
+
+	if len(bus.subjects) != 0 {
+		t.Errorf("Expected no bus subscriptions after leaving the cluster, but got %d subjects", len(bus.subjects))
+	}
+}
+
+func TestConnectionRegistry_JoinCluster_SubscribeError(t *testing.T) {
+	bus := mocks.NewMockMessageBus(t)
+	registry := NewConnectionRegistry()
+
+	unsubscribed := false
+
+	bus.EXPECT().Subscribe(clusterNodeSubject("node1"), mock.Anything).Return(func() { unsubscribed = true }, nil)
+	bus.EXPECT().Subscribe(clusterBroadcastSubject, mock.Anything).Return(nil, errors.New("bus is down"))
+
+	if err := registry.JoinCluster("node1", bus); err == nil || !strings.Contains(err.Error(), "bus is down") {
+		t.Errorf("Expected subscribe error, but got %v", err)
+	}
+
+	if !unsubscribed {
+		t.Error("Expected subscriptions to be removed after the error")
+	}
+
+	if registry.NodeID() != "" {
+		t.Error("Expected registry not to be in cluster after the error")
+	}
+}
+
+func TestConnectionRegistry_SendTo(t *testing.T) {
+	bus := NewMemoryBus()
+	nodeA := NewConnectionRegistry()
+	nodeB := NewConnectionRegistry()
+
+	if err := nodeA.SendTo(context.Background(), "conn", wasabi.MsgTypeText, []byte("hello")); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("Expected error %v without cluster, but got %v", ErrConnectionNotFound, err)
+	}
+
+	if err := nodeA.JoinCluster("a", bus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := nodeB.JoinCluster("b", bus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	local := clusterConnection(t, "a:local")
+	local.EXPECT().Send(wasabi.MsgTypeText, []byte("local")).Return(nil)
+
+	routed := clusterConnection(t, "b:routed")
+	routed.EXPECT().Send(wasabi.MsgTypeText, []byte("routed")).Return(nil)
+
+	// Connections of channels that generate their own ids are found by broadcast.
+	broadcast := clusterConnection(t, "broadcast")
+	broadcast.EXPECT().Send(wasabi.MsgTypeBinary, []byte("broadcast")).Return(nil)
+
+	for registry, conn := range map[*ConnectionRegistry]wasabi.Connection{nodeA: local, nodeB: routed} {
+		if err := registry.Register(conn); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := nodeB.Register(broadcast); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		expectedErr error
+		id          string
+		msg         string
+		msgType     wasabi.MessageType
+	}{
+		{id: "a:local", msgType: wasabi.MsgTypeText, msg: "local"},
+		{id: "b:routed", msgType: wasabi.MsgTypeText, msg: "routed"},
+		{id: "broadcast", msgType: wasabi.MsgTypeBinary, msg: "broadcast"},
+		{id: "a:gone", msgType: wasabi.MsgTypeText, msg: "gone", expectedErr: ErrConnectionNotFound},
+		{id: "c:unknown", msgType: wasabi.MsgTypeText, msg: "unknown"},
+	}
+
+	for _, tt := range tests {
+		err := nodeA.SendTo(context.Background(), tt.id, tt.msgType, []byte(tt.msg))
+		if !errors.Is(err, tt.expectedErr) {
+			t.Errorf("Unexpected error sending to %q: got %v, expected %v", tt.id, err, tt.expectedErr)
+		}
+	}
+}
+
+func TestConnectionRegistry_SendTo_BusError(t *testing.T) {
+	bus := mocks.NewMockMessageBus(t)
+	registry := NewConnectionRegistry()
+
+	bus.EXPECT().Subscribe(mock.Anything, mock.Anything).Return(func() {}, nil)
+	bus.EXPECT().Publish(mock.Anything, clusterNodeSubject("b"), mock.Anything).Return(errors.New("bus is down"))
+
+	if err := registry.JoinCluster("a", bus); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := registry.SendTo(context.Background(), "b:conn", wasabi.MsgTypeText, []byte("hello")); err == nil {
+		t.Error("Expected bus error")
+	}
+}
+
+func TestConnectionRegistry_Publish_Cluster(t *testing.T) {
+	bus := NewMemoryBus()
+	nodeA := NewConnectionRegistry()
+	nodeB := NewConnectionRegistry()
+
+	for _, node := range []struct {
+		registry *ConnectionRegistry
+		id       string
+	}{{nodeA, "a"}, {nodeB, "b"}} {
+		if err := node.registry.JoinCluster(node.id, bus); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Every subscriber gets the message exactly once, mocks fail on repeated calls.
+	subA := clusterConnection(t, "a:sub")
+	subA.EXPECT().Send(wasabi.MsgTypeText, []byte("news")).Return(nil).Once()
+
+	subB := clusterConnection(t, "b:sub")
+	subB.EXPECT().Send(wasabi.MsgTypeText, []byte("news")).Return(nil).Once()
+
+	for registry, conn := range map[*ConnectionRegistry]wasabi.Connection{nodeA: subA, nodeB: subB} {
+		if err := registry.Register(conn); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := registry.Subscribe(conn.ID(), "topic"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if sent := nodeA.Publish("topic", wasabi.MsgTypeText, []byte("news")); sent != 1 {
+		t.Errorf("Unexpected number of local deliveries: got %d, expected %d", sent, 1)
+	}
+}
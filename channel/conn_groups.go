@@ -0,0 +1,163 @@
+package channel
+
+import (
+	"sync"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// connGroups is a many-to-many index between named groups and connections.
+// It has its own lock, so lookups and membership changes do not contend with the registry lock.
+type connGroups struct {
+	groups  map[string]map[string]wasabi.Connection
+	members map[string]map[string]struct{}
+	mu      sync.RWMutex
+}
+
+// newConnGroups creates new instance of connGroups
+func newConnGroups() *connGroups {
+	return &connGroups{
+		groups:  make(map[string]map[string]wasabi.Connection),
+		members: make(map[string]map[string]struct{}),
+	}
+}
+
+// add adds connection to the group.
+// It returns false if the connection is already a member of the group.
+func (g *connGroups) add(group string, conn wasabi.Connection) bool {
+	id := conn.ID()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	conns, ok := g.groups[group]
+	if !ok {
+		conns = make(map[string]wasabi.Connection)
+		g.groups[group] = conns
+	}
+
+	if _, ok := conns[id]; ok {
+		return false
+	}
+
+	conns[id] = conn
+
+	memberOf, ok := g.members[id]
+	if !ok {
+		memberOf = make(map[string]struct{})
+		g.members[id] = memberOf
+	}
+
+	memberOf[group] = struct{}{}
+
+	return true
+}
+
+// remove removes connection with the given id from the group.
+// It returns false if the connection is not a member of the group.
+func (g *connGroups) remove(group, id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.removeLocked(group, id)
+}
+
+// removeAll removes connection with the given id from all groups it is a member of.
+// Connections that are not members of any group are checked under the read lock,
+// so disconnects of such connections don't contend with each other.
+func (g *connGroups) removeAll(id string) {
+	g.mu.RLock()
+	_, ok := g.members[id]
+	g.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for group := range g.members[id] {
+		g.removeLocked(group, id)
+	}
+}
+
+// replace replaces the stored connection with the given one in all groups the connection with the same id
+// is a member of, e.g. when a suspended session is resumed by the new connection.
+func (g *connGroups) replace(conn wasabi.Connection) {
+	id := conn.ID()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for group := range g.members[id] {
+		g.groups[group][id] = conn
+	}
+}
+
+// removeLocked removes connection from the group, the caller must hold the write lock.
+func (g *connGroups) removeLocked(group, id string) bool {
+	conns, ok := g.groups[group]
+	if !ok {
+		return false
+	}
+
+	if _, ok := conns[id]; !ok {
+		return false
+	}
+
+	delete(conns, id)
+
+	if len(conns) == 0 {
+		delete(g.groups, group)
+	}
+
+	if memberOf, ok := g.members[id]; ok {
+		delete(memberOf, group)
+
+		if len(memberOf) == 0 {
+			delete(g.members, id)
+		}
+	}
+
+	return true
+}
+
+// get returns a snapshot of connections that are members of the group.
+// The snapshot can be used without holding any locks.
+func (g *connGroups) get(group string) []wasabi.Connection {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	conns := g.groups[group]
+	result := make([]wasabi.Connection, 0, len(conns))
+
+	for _, conn := range conns {
+		result = append(result, conn)
+	}
+
+	return result
+}
+
+// groupsOf returns list of groups the connection with the given id is a member of.
+func (g *connGroups) groupsOf(id string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	memberOf := g.members[id]
+	result := make([]string, 0, len(memberOf))
+
+	for group := range memberOf {
+		result = append(result, group)
+	}
+
+	return result
+}
+
+// size returns number of connections in the group.
+func (g *connGroups) size(group string) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return len(g.groups[group])
+}
@@ -0,0 +1,161 @@
+package channel
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// connMapShards is the number of shards of connMap, it's a power of two so the shard is selected with a mask.
+const connMapShards = 64
+
+// connMap is a concurrent map of connections by id.
+// Connections are spread over shards with their own locks, so connects and disconnects of different connections
+// rarely contend with each other, and the number of connections is tracked with an atomic counter
+// that is read without locking.
+type connMap struct {
+	shards [connMapShards]connShard
+	seed   maphash.Seed
+	count  atomic.Int64
+}
+
+// connShard is a shard of connMap.
+type connShard struct {
+	conns map[string]wasabi.Connection
+	mu    sync.RWMutex
+	// Shards are padded to the cache line size, so locking one shard doesn't invalidate its neighbours.
+	_ [32]byte
+}
+
+// newConnMap creates new instance of connMap
+func newConnMap() *connMap {
+	m := &connMap{
+		seed: maphash.MakeSeed(),
+	}
+
+	for i := range m.shards {
+		m.shards[i].conns = make(map[string]wasabi.Connection)
+	}
+
+	return m
+}
+
+// shard returns the shard for the connection id.
+func (m *connMap) shard(id string) *connShard {
+	return &m.shards[maphash.String(m.seed, id)&(connMapShards-1)]
+}
+
+// add adds the connection to the map, replacing the connection with the same id.
+// If limit is positive, the connection is added only if the map holds fewer connections than the limit,
+// it returns false otherwise.
+func (m *connMap) add(id string, conn wasabi.Connection, limit int) bool {
+	if !m.reserve(limit) {
+		return false
+	}
+
+	s := m.shard(id)
+
+	s.mu.Lock()
+	_, replaced := s.conns[id]
+	s.conns[id] = conn
+	s.mu.Unlock()
+
+	if replaced {
+		m.count.Add(-1)
+	}
+
+	return true
+}
+
+// reserve increments the counter if it's below the limit, non-positive limit means no limit.
+func (m *connMap) reserve(limit int) bool {
+	if limit <= 0 {
+		m.count.Add(1)
+		return true
+	}
+
+	for {
+		n := m.count.Load()
+		if n >= int64(limit) {
+			return false
+		}
+
+		if m.count.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// get returns the connection with the given id.
+func (m *connMap) get(id string) (wasabi.Connection, bool) {
+	s := m.shard(id)
+
+	s.mu.RLock()
+	conn, ok := s.conns[id]
+	s.mu.RUnlock()
+
+	return conn, ok
+}
+
+// delete removes the connection with the given id, it returns the removed connection or nil.
+func (m *connMap) delete(id string) wasabi.Connection {
+	s := m.shard(id)
+
+	s.mu.Lock()
+	conn, ok := s.conns[id]
+	delete(s.conns, id)
+	s.mu.Unlock()
+
+	if ok {
+		m.count.Add(-1)
+	}
+
+	return conn
+}
+
+// compareAndDelete removes the connection with the given id only if it's the given connection.
+// It returns false if the connection is not in the map.
+func (m *connMap) compareAndDelete(id string, conn wasabi.Connection) bool {
+	s := m.shard(id)
+
+	s.mu.Lock()
+
+	if s.conns[id] != conn {
+		s.mu.Unlock()
+		return false
+	}
+
+	delete(s.conns, id)
+	s.mu.Unlock()
+
+	m.count.Add(-1)
+
+	return true
+}
+
+// len returns number of connections in the map.
+func (m *connMap) len() int {
+	return int(m.count.Load())
+}
+
+// snapshot returns list of connections in the map.
+// Shards are copied one by one, so the snapshot is not atomic across shards.
+func (m *connMap) snapshot() []wasabi.Connection {
+	connections := make([]wasabi.Connection, 0, m.len())
+
+	for i := range m.shards {
+		s := &m.shards[i]
+
+		s.mu.RLock()
+
+		for _, conn := range s.conns {
+			connections = append(connections, conn)
+		}
+
+		s.mu.RUnlock()
+	}
+
+	return connections
+}
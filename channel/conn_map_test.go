@@ -0,0 +1,109 @@
+package channel
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/coder/websocket"
+)
+
+func TestConnMap(t *testing.T) {
+	m := newConnMap()
+
+	conn1 := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+	conn2 := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+
+	if !m.add(conn1.ID(), conn1, 0) || !m.add(conn2.ID(), conn2, 0) {
+		t.Fatal("Expected connections to be added")
+	}
+
+	if m.len() != 2 {
+		t.Errorf("Unexpected number of connections: got %d, expected %d", m.len(), 2)
+	}
+
+	if conn, ok := m.get(conn1.ID()); !ok || conn != conn1 {
+		t.Errorf("Unexpected connection: got %v, expected %v", conn, conn1)
+	}
+
+	if len(m.snapshot()) != 2 {
+		t.Errorf("Unexpected snapshot size: got %d, expected %d", len(m.snapshot()), 2)
+	}
+
+	// Replacing the connection with the same id doesn't change the number of connections.
+	m.add(conn1.ID(), conn2, 0)
+
+	if m.len() != 2 {
+		t.Errorf("Unexpected number of connections after replace: got %d, expected %d", m.len(), 2)
+	}
+
+	if m.compareAndDelete(conn1.ID(), conn1) {
+		t.Error("Expected replaced connection not to be deleted")
+	}
+
+	if !m.compareAndDelete(conn1.ID(), conn2) {
+		t.Error("Expected connection to be deleted")
+	}
+
+	if conn := m.delete(conn2.ID()); conn != conn2 {
+		t.Errorf("Unexpected deleted connection: got %v, expected %v", conn, conn2)
+	}
+
+	if conn := m.delete(conn2.ID()); conn != nil {
+		t.Errorf("Expected no connection to be deleted, but got %v", conn)
+	}
+
+	if _, ok := m.get(conn2.ID()); ok {
+		t.Error("Expected connection to be deleted")
+	}
+
+	if m.len() != 0 {
+		t.Errorf("Unexpected number of connections: got %d, expected %d", m.len(), 0)
+	}
+}
+
+func TestConnMap_Limit(t *testing.T) {
+	const limit = 10
+
+	m := newConnMap()
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added []string
+	)
+
+	for i := range 100 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			id := "conn" + strconv.Itoa(i)
+
+			if m.add(id, conn, limit) {
+				mu.Lock()
+				added = append(added, id)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(added) != limit || m.len() != limit {
+		t.Fatalf("Expected %d connections to be added, but got %d with length %d", limit, len(added), m.len())
+	}
+
+	if m.add("extra", conn, limit) {
+		t.Error("Expected connection over the limit to be rejected")
+	}
+
+	m.delete(added[0])
+
+	if !m.add("extra", conn, limit) {
+		t.Error("Expected connection to be added after another one was deleted")
+	}
+}
@@ -1,6 +1,7 @@
 package channel
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -8,7 +9,6 @@ import (
 	"net"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
 	"github.com/coder/websocket"
@@ -22,6 +22,10 @@ var (
 	ErrConnectionClosed = errors.New("connection is closed")
 )
 
+// AttrSubprotocol is the connection attribute with the WebSocket subprotocol negotiated during the handshake,
+// it's not set if no subprotocol was negotiated.
+const AttrSubprotocol = "wasabi.subprotocol"
+
 type state int32
 
 const (
@@ -32,29 +36,55 @@ const (
 
 // Conn is default implementation of Connection
 type Conn struct {
-	ctx             context.Context
-	ws              *websocket.Conn
-	reqWG           *sync.WaitGroup
-	onMessageCB     wasabi.OnMessage
-	ctxCancel       context.CancelFunc
-	bufferPool      *bufferPool
-	state           *atomic.Int32
-	sem             chan struct{}
-	inActiveTimer   *time.Timer
-	id              string
-	inActiveTimeout time.Duration
+	ctx                context.Context
+	ws                 *websocket.Conn
+	reqWG              *sync.WaitGroup
+	onMessageCB        wasabi.OnMessage
+	onStreamCB         wasabi.OnMessageStream
+	ctxCancel          context.CancelCauseFunc
+	bufferPool         BufferPool
+	state              *atomic.Int32
+	sem                chan struct{}
+	inActiveTimer      *time.Timer
+	readIdleTimer      *time.Timer
+	writeIdleTimer     *time.Timer
+	lifetimeTimer      *time.Timer
+	sendQueue          *sendQueue
+	session            *session
+	executor           *orderedExecutor
+	limiter            *inboundLimiter
+	partitionKey       PartitionKeyFunc
+	attrs              *sync.Map
+	payloads           map[*byte]*lentPayload
+	closeInfo          atomic.Pointer[wasabi.CloseInfo]
+	id                 string
+	inActiveTimeout    time.Duration
+	readIdleTimeout    time.Duration
+	writeIdleTimeout   time.Duration
+	maxLifetime        time.Duration
+	heartbeatInterval  time.Duration
+	heartbeatMaxMissed int
+	lastMsgSize        int
+	rtt                atomic.Int64
+	readParks          atomic.Uint64
+	payloadsMu         sync.Mutex
+	poisonPayloads     bool
 }
 
+// connOption is a function type that represents options for configuring a Conn.
+type connOption func(*Conn)
+
 // NewConnection creates new instance of websocket connection
 func NewConnection(
 	ctx context.Context,
 	ws *websocket.Conn,
 	cb wasabi.OnMessage,
-	bufferPool *bufferPool,
+	bufferPool BufferPool,
 	concurrencyLimit uint,
 	inActivityTimeout time.Duration,
+	opts ...connOption,
 ) *Conn {
-	ctx, cancel := context.WithCancel(ctx)
+	ctx, cancel := context.WithCancelCause(ctx)
 	state := atomic.Int32{}
 	state.Store(int32(connected))
 
@@ -69,6 +99,20 @@ func NewConnection(
 		bufferPool:      bufferPool,
 		sem:             make(chan struct{}, concurrencyLimit),
 		inActiveTimeout: inActivityTimeout,
+		attrs:           &sync.Map{},
+		payloads:        make(map[*byte]*lentPayload),
+	}
+
+	for key, value := range wasabi.AttrsFromContext(ctx) {
+		conn.attrs.Store(key, value)
+	}
+
+	if proto := ws.Subprotocol(); proto != "" {
+		conn.attrs.Store(AttrSubprotocol, proto)
+	}
+
+	for _, opt := range opts {
+		opt(conn)
 	}
 
 	if conn.inActiveTimeout > 0 {
@@ -76,6 +120,19 @@ func NewConnection(
 		go conn.watchInactivity()
 	}
 
+	if conn.readIdleTimeout > 0 || conn.writeIdleTimeout > 0 || conn.maxLifetime > 0 {
+		conn.startTimeouts()
+		go conn.watchTimeouts()
+	}
+
+	if conn.heartbeatInterval > 0 {
+		go conn.heartbeat()
+	}
+
+	if conn.sendQueue != nil {
+		go conn.writeQueued()
+	}
+
 	return conn
 }
 
@@ -84,36 +141,94 @@ func (c *Conn) ID() string {
 	return c.id
 }
 
+// String returns the connection id, so connections are formatted by id instead of dumping their state,
+// which is modified concurrently while the connection is closing.
+func (c *Conn) String() string {
+	return c.id
+}
+
 // Context returns connection context
 func (c *Conn) Context() context.Context {
 	return c.ctx
 }
 
+// Subprotocol returns the WebSocket subprotocol negotiated during the handshake.
+// It returns an empty string if no subprotocol was negotiated.
+// Handlers that get the connection as wasabi.Connection can read it from the AttrSubprotocol attribute.
+func (c *Conn) Subprotocol() string {
+	return c.ws.Subprotocol()
+}
+
+// Attr returns value of the connection attribute with the given key.
+// Initial attributes are populated from the handshake context, see wasabi.ContextWithAttrs.
+func (c *Conn) Attr(key string) (any, bool) {
+	return c.attrs.Load(key)
+}
+
+// SetAttr sets value of the connection attribute with the given key.
+// It's safe to call SetAttr concurrently from multiple goroutines.
+func (c *Conn) SetAttr(key string, value any) {
+	c.attrs.Store(key, value)
+}
+
+// RTT returns round-trip time measured by the last successful heartbeat ping.
+// It returns 0 if heartbeat is disabled or no ping has been completed yet.
+func (c *Conn) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// QueueLen returns number of messages waiting in the send queue.
+// It returns 0 if the send queue is disabled.
+func (c *Conn) QueueLen() int {
+	if c.sendQueue == nil {
+		return 0
+	}
+
+	return c.sendQueue.len()
+}
+
+// DroppedMessages returns number of outgoing messages dropped because the send queue was full.
+// It returns 0 if the send queue is disabled.
+func (c *Conn) DroppedMessages() uint64 {
+	if c.sendQueue == nil {
+		return 0
+	}
+
+	return c.sendQueue.dropped.Load()
+}
+
 // handleRequests handles incoming messages
 func (c *Conn) handleRequests() {
+	if c.onStreamCB != nil {
+		c.handleStreams()
+		return
+	}
+
 	defer c.close()
 
 	for c.ctx.Err() == nil {
-		c.sem <- struct{}{}
+		c.acquireSlot()
 
-		if c.inActiveTimeout > 0 {
-			c.inActiveTimer.Reset(c.inActiveTimeout)
-		}
+		c.touchRead()
 
-		buffer := c.bufferPool.get()
+		buffer := c.bufferPool.Get(c.lastMsgSize)
 
 		msgType, reader, err := c.ws.Reader(c.ctx)
 		if err != nil {
+			c.recordCloseInfo(readCloseInfo(err))
 			return
 		}
 
 		_, err = buffer.ReadFrom(reader)
+		c.lastMsgSize = buffer.Len()
 
 		if c.state.Load() == int32(closing) {
 			continue
 		}
 
 		if err != nil {
+			c.recordCloseInfo(readCloseInfo(err))
+
 			switch {
 			case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
 				return
@@ -126,39 +241,290 @@ func (c *Conn) handleRequests() {
 			return
 		}
 
+		if !c.limitInbound(1, buffer.Len()) {
+			return
+		}
+
+		c.reqWG.Add(1)
+
+		c.dispatch(msgType, buffer)
+	}
+}
+
+// dispatch passes the message to the OnMessage callback.
+// By default, every message is processed in its own goroutine,
+// in ordered mode, messages are processed sequentially per connection or per partition key.
+func (c *Conn) dispatch(msgType wasabi.MessageType, buffer *bytes.Buffer) {
+	task := func() {
+		defer c.reqWG.Done()
+
+		key := c.lendPayload(buffer)
+
+		c.onMessageCB(c, msgType, buffer.Bytes())
+		c.releasePayload(key, buffer)
+		<-c.sem
+	}
+
+	key := ""
+	if c.executor != nil && c.partitionKey != nil {
+		key = c.partitionKey(msgType, buffer.Bytes())
+	}
+
+	c.run(key, task)
+}
+
+// handleStreams handles incoming messages in streaming mode.
+// Every message is passed to the OnMessageStream callback as soon as it starts arriving,
+// the next message is read only after the current one is consumed by the callback or discarded.
+func (c *Conn) handleStreams() {
+	defer c.close()
+
+	for c.ctx.Err() == nil {
+		c.acquireSlot()
+
+		c.touchRead()
+
+		msgType, reader, err := c.ws.Reader(c.ctx)
+		if err != nil {
+			c.recordCloseInfo(readCloseInfo(err))
+			return
+		}
+
+		// Size of the stream is unknown before it's consumed, so its bytes are charged after that.
+		if !c.limitInbound(1, 0) {
+			return
+		}
+
+		stream := newMessageStream(reader)
+
 		c.reqWG.Add(1)
 
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
+		// Streams can't be partitioned by the content, so in ordered mode they are ordered per connection.
+		c.run("", func() {
+			defer c.reqWG.Done()
 
-			c.onMessageCB(c, msgType, buffer.Bytes())
-			c.bufferPool.put(buffer)
+			c.onStreamCB(c, msgType, stream)
+			stream.discard()
 			<-c.sem
-		}(c.reqWG)
+		})
+
+		// The connection is not read until the callback consumes the stream.
+		c.parkReads()
+
+		select {
+		case <-stream.done:
+		case <-c.ctx.Done():
+			c.unparkReads()
+			return
+		}
+
+		c.unparkReads()
+
+		if c.state.Load() == int32(closing) {
+			continue
+		}
+
+		err = stream.result()
+
+		if !errors.Is(err, io.EOF) {
+			c.recordCloseInfo(readCloseInfo(err))
+		}
+
+		switch {
+		case errors.Is(err, io.EOF):
+			if !c.limitInbound(0, stream.size()) {
+				return
+			}
+		case errors.Is(err, net.ErrClosed), errors.Is(err, context.Canceled):
+			return
+		default:
+			slog.Warn("Error reading message: " + err.Error())
+			return
+		}
+	}
+}
+
+// acquireSlot takes a slot of the concurrency limit before the next message is read,
+// reads are parked while all slots are taken by messages in progress.
+func (c *Conn) acquireSlot() {
+	select {
+	case c.sem <- struct{}{}:
+	default:
+		c.parkReads()
+		c.sem <- struct{}{}
+		c.unparkReads()
 	}
 }
 
+// parkReads marks that the read loop stopped reading the connection, e.g. it waits for a free concurrency slot.
+// Pongs are processed only while the connection is read, so missed pings are not counted while reads are parked.
+// The counter is incremented on park and on unpark, so it's odd while reads are parked.
+func (c *Conn) parkReads() {
+	c.readParks.Add(1)
+}
+
+// unparkReads marks that the read loop resumed reading the connection.
+func (c *Conn) unparkReads() {
+	c.readParks.Add(1)
+}
+
+// limitInbound charges the incoming message against the inbound rate limits before it's dispatched.
+// Over the limits, it either waits until the connection is within the limits,
+// or closes the connection with status 1008 (policy violation), depending on the limit action.
+// It returns false if the connection is closed and must stop reading.
+func (c *Conn) limitInbound(messages, bytes int) bool {
+	if c.limiter == nil {
+		return true
+	}
+
+	delay, ok := c.limiter.reserve(messages, bytes)
+	if !ok {
+		_ = c.closeWith(serverClose(websocket.StatusPolicyViolation, "rate limit exceeded", ErrRateLimitExceeded))
+		return false
+	}
+
+	if delay > 0 {
+		c.parkReads()
+		defer c.unparkReads()
+	}
+
+	if !waitDelay(c.ctx, delay) {
+		return false
+	}
+
+	// The client is active while it's being throttled, so the delay doesn't count as inactivity.
+	if delay > 0 {
+		c.touchRead()
+	}
+
+	return true
+}
+
+// run executes the task in its own goroutine,
+// or in the order of submission within the key if ordered processing is enabled.
+func (c *Conn) run(key string, task func()) {
+	if c.executor == nil {
+		go task()
+		return
+	}
+
+	c.executor.submit(key, task)
+}
+
 // Send sends message to connection
+// If the send queue is enabled, the message is copied to the queue and written by the connection writer,
+// in this case the behavior on a full queue is defined by the overflow policy.
+// If session resumption is enabled, the message is sent through the session of the connection,
+// so it's kept for replay, and it's delivered to the connection that resumed the session if the original one is gone.
 func (c *Conn) Send(msgType wasabi.MessageType, msg []byte) error {
+	if c.session != nil {
+		return c.session.send(msgType, msg)
+	}
+
+	return c.deliver(msgType, msg)
+}
+
+// deliver sends message to the client of this connection
+func (c *Conn) deliver(msgType wasabi.MessageType, msg []byte) error {
 	if c.ctx.Err() != nil {
 		return ErrConnectionClosed
 	}
 
-	if c.inActiveTimeout > 0 {
-		c.inActiveTimer.Reset(c.inActiveTimeout)
+	c.touchWrite()
+
+	if c.sendQueue != nil {
+		return c.enqueue(msgType, msg)
 	}
 
-	err := c.ws.Write(c.ctx, msgType, msg)
+	return c.write(msgType, msg)
+}
+
+// enqueue puts a copy of the message to the send queue.
+// If the queue is full and overflow policy is OverflowClose, it closes the connection with status 1008 (policy violation).
+func (c *Conn) enqueue(msgType wasabi.MessageType, msg []byte) error {
+	data := make([]byte, len(msg))
+	copy(data, msg)
+
+	err := c.sendQueue.push(c.ctx, outMessage{msgType: msgType, data: data})
+	if errors.Is(err, errSendQueueFull) {
+		go func() {
+			_ = c.closeWith(serverClose(websocket.StatusPolicyViolation, "send queue overflow", ErrSendQueueOverflow))
+		}()
 
-	if errors.Is(err, syscall.EPIPE) {
-		return ErrConnectionClosed
-	} else if errors.Is(err, net.ErrClosed) {
 		return ErrConnectionClosed
 	}
 
 	return err
 }
 
+// writeQueued writes messages from the send queue to the connection until the connection is closed.
+func (c *Conn) writeQueued() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg := <-c.sendQueue.messages:
+			if msg.flushed != nil {
+				close(msg.flushed)
+				continue
+			}
+
+			if err := c.write(msg.msgType, msg.data); err != nil && !errors.Is(err, ErrConnectionClosed) && c.ctx.Err() == nil {
+				slog.Warn("Error writing message: " + err.Error())
+			}
+		}
+	}
+}
+
+// write writes message to the underlying websocket connection
+func (c *Conn) write(msgType wasabi.MessageType, msg []byte) error {
+	return mapWriteError(c.ws.Write(c.ctx, msgType, msg))
+}
+
+// Writer returns writer that streams a single message to the connection frame by frame,
+// the message is completed when the writer is closed.
+// Until then, other messages can't be written to the connection, so the writer must always be closed.
+// If the send queue or session resumption is enabled, the message is collected in memory
+// and sent with Send when the writer is closed, so it keeps its order in the queue and can be replayed.
+func (c *Conn) Writer(msgType wasabi.MessageType) (io.WriteCloser, error) {
+	if c.ctx.Err() != nil {
+		return nil, ErrConnectionClosed
+	}
+
+	if c.session != nil || c.sendQueue != nil {
+		return newBufferedWriter(func(msg []byte) error {
+			return c.Send(msgType, msg)
+		}), nil
+	}
+
+	c.touchWrite()
+
+	w, err := c.ws.Writer(c.ctx, msgType)
+	if err != nil {
+		return nil, mapWriteError(err)
+	}
+
+	return &connWriter{writer: w}, nil
+}
+
+// CloseInfo returns how and why the connection was closed.
+// It returns nil until the connection starts closing.
+func (c *Conn) CloseInfo() *wasabi.CloseInfo {
+	return c.closeInfo.Load()
+}
+
+// recordCloseInfo records the close info if it's not recorded yet, the first cause of the close wins.
+// It returns the recorded close info.
+func (c *Conn) recordCloseInfo(info *wasabi.CloseInfo) *wasabi.CloseInfo {
+	return recordCloseInfo(&c.closeInfo, info)
+}
+
+// closeCause returns the recorded close info to cancel the connection context with,
+// connections that are terminated without known cause are recorded as abnormal closure by the server.
+func (c *Conn) closeCause() *wasabi.CloseInfo {
+	return c.recordCloseInfo(serverClose(websocket.StatusAbnormalClosure, "", nil))
+}
+
 // close closes the connection.
 // It cancels the context
 // marks the connection as closed, and waits for any pending requests to complete.
@@ -168,7 +534,7 @@ func (c *Conn) close() {
 		return
 	}
 
-	c.ctxCancel()
+	c.ctxCancel(c.closeCause())
 
 	// Terminate the connection immediately.
 	_ = c.ws.CloseNow()
@@ -185,10 +551,17 @@ func (c *Conn) close() {
 // closed immediately. After closing the connection, the connection state is
 // set to terminated
 func (c *Conn) Close(status websocket.StatusCode, reason string, ctx ...context.Context) error {
+	return c.closeWith(serverClose(status, reason, nil), ctx...)
+}
+
+// closeWith closes the connection the same way as Close, and records the close info with the cause of the close.
+func (c *Conn) closeWith(info *wasabi.CloseInfo, ctx ...context.Context) error {
 	if !c.state.CompareAndSwap(int32(connected), int32(closing)) {
 		return ErrConnectionClosed
 	}
 
+	info = c.recordCloseInfo(info)
+
 	if len(ctx) > 0 {
 		done := make(chan struct{})
 
@@ -202,11 +575,22 @@ func (c *Conn) Close(status websocket.StatusCode, reason string, ctx ...context.
 		case <-done: // If there are no pending requests, we can close the connection immediately.
 		case <-c.ctx.Done(): // If the connection is already closed, we should not wait for pending requests.
 		}
+
+		if c.sendQueue != nil {
+			// Give the writer a chance to deliver queued messages before the close frame.
+			flushCtx, cancel := context.WithCancel(ctx[0])
+			stop := context.AfterFunc(c.ctx, cancel)
+
+			c.sendQueue.flush(flushCtx)
+
+			stop()
+			cancel()
+		}
 	}
 
-	_ = c.ws.Close(status, reason)
+	_ = c.ws.Close(info.Code, info.Reason)
 
-	c.ctxCancel()
+	c.ctxCancel(info)
 	c.state.Store(int32(terminated))
 
 	return nil
@@ -222,8 +606,199 @@ func (c *Conn) watchInactivity() {
 		case <-c.ctx.Done():
 			return
 		case <-c.inActiveTimer.C:
-			_ = c.Close(websocket.StatusGoingAway, "inactivity timeout")
+			_ = c.closeWith(serverClose(websocket.StatusGoingAway, "inactivity timeout", ErrInactivityTimeout))
 			return
 		}
 	}
 }
+
+// startTimeouts starts the read idle, write idle and lifetime timers of the connection.
+func (c *Conn) startTimeouts() {
+	if c.readIdleTimeout > 0 {
+		c.readIdleTimer = time.NewTimer(c.readIdleTimeout)
+	}
+
+	if c.writeIdleTimeout > 0 {
+		c.writeIdleTimer = time.NewTimer(c.writeIdleTimeout)
+	}
+
+	if c.maxLifetime > 0 {
+		c.lifetimeTimer = time.NewTimer(c.maxLifetime)
+	}
+}
+
+// touchRead resets the timers that track incoming activity.
+func (c *Conn) touchRead() {
+	if c.inActiveTimeout > 0 {
+		c.inActiveTimer.Reset(c.inActiveTimeout)
+	}
+
+	if c.readIdleTimeout > 0 {
+		c.readIdleTimer.Reset(c.readIdleTimeout)
+	}
+}
+
+// touchWrite resets the timers that track outgoing activity.
+func (c *Conn) touchWrite() {
+	if c.inActiveTimeout > 0 {
+		c.inActiveTimer.Reset(c.inActiveTimeout)
+	}
+
+	if c.writeIdleTimeout > 0 {
+		c.writeIdleTimer.Reset(c.writeIdleTimeout)
+	}
+}
+
+// watchTimeouts closes the connection when it doesn't receive or send messages within the idle timeouts,
+// or when it reaches its maximum lifetime.
+func (c *Conn) watchTimeouts() {
+	defer stopTimers(c.readIdleTimer, c.writeIdleTimer, c.lifetimeTimer)
+
+	var info *wasabi.CloseInfo
+
+	select {
+	case <-c.ctx.Done():
+		return
+	case <-timerC(c.readIdleTimer):
+		info = serverClose(websocket.StatusGoingAway, "read idle timeout", ErrReadIdleTimeout)
+	case <-timerC(c.writeIdleTimer):
+		info = serverClose(websocket.StatusGoingAway, "write idle timeout", ErrWriteIdleTimeout)
+	case <-timerC(c.lifetimeTimer):
+		info = serverClose(websocket.StatusGoingAway, "max connection lifetime reached", ErrMaxLifetimeReached)
+	}
+
+	_ = c.closeWith(info)
+}
+
+// timerC returns the channel of the timer, or nil channel that blocks forever if the timer is not set.
+func timerC(t *time.Timer) <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+
+	return t.C
+}
+
+// stopTimers stops the timers that are set.
+func stopTimers(timers ...*time.Timer) {
+	for _, t := range timers {
+		if t != nil {
+			t.Stop()
+		}
+	}
+}
+
+// heartbeat periodically sends ping frames to the client and measures round-trip time.
+// Each ping waits for the pong up to the heartbeat interval,
+// if the number of consecutive missed pongs reaches the limit, it terminates the connection.
+// Pings that fail while reads are parked are not counted as missed, because their pongs can't be read.
+func (c *Conn) heartbeat() {
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+
+	missed := 0
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			parks := c.readParks.Load()
+			if parks%2 == 1 {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(c.ctx, c.heartbeatInterval)
+			start := time.Now()
+			err := c.ws.Ping(ctx)
+
+			cancel()
+
+			if c.ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				if c.readParks.Load() != parks {
+					continue
+				}
+
+				missed++
+
+				if missed >= c.heartbeatMaxMissed {
+					// The peer is considered dead, so there is no point to wait for the closing handshake.
+					c.recordCloseInfo(serverClose(websocket.StatusAbnormalClosure, "heartbeat timeout", ErrHeartbeatTimeout))
+					c.close()
+					return
+				}
+
+				continue
+			}
+
+			missed = 0
+
+			c.rtt.Store(int64(time.Since(start)))
+		}
+	}
+}
+
+// withID sets the connection id instead of generated one.
+func withID(id string) connOption {
+	return func(c *Conn) {
+		c.id = id
+	}
+}
+
+// withSendQueue enables bounded send queue for outgoing messages with a dedicated writer.
+func withSendQueue(size int, policy OverflowPolicy, timeout time.Duration) connOption {
+	return func(c *Conn) {
+		c.sendQueue = newSendQueue(size, policy, timeout)
+	}
+}
+
+// withOrderedProcessing makes the connection process messages sequentially in the order they were received.
+// If partitionKey is not nil, the order is kept only for messages with the same partition key.
+func withOrderedProcessing(partitionKey PartitionKeyFunc) connOption {
+	return func(c *Conn) {
+		c.executor = newOrderedExecutor()
+		c.partitionKey = partitionKey
+	}
+}
+
+// withStreamHandler switches the connection to streaming mode, incoming messages are passed to cb as readers.
+func withStreamHandler(cb wasabi.OnMessageStream) connOption {
+	return func(c *Conn) {
+		c.onStreamCB = cb
+	}
+}
+
+// withInboundLimits returns a connOption that enables rate limits of incoming messages.
+func withInboundLimits(messages, bytes rateLimit, action LimitAction) connOption {
+	return func(c *Conn) {
+		c.limiter = newInboundLimiter(messages, bytes, action)
+	}
+}
+
+// withIdleTimeouts returns a connOption that sets separate timeouts for incoming and outgoing messages.
+func withIdleTimeouts(read, write time.Duration) connOption {
+	return func(c *Conn) {
+		c.readIdleTimeout = read
+		c.writeIdleTimeout = write
+	}
+}
+
+// withMaxLifetime returns a connOption that sets the maximum lifetime of the connection.
+func withMaxLifetime(lifetime time.Duration) connOption {
+	return func(c *Conn) {
+		c.maxLifetime = lifetime
+	}
+}
+
+// withHeartbeat enables sending ping frames to the client with the given interval,
+// the connection is closed after maxMissed consecutive pings are left without pong.
+func withHeartbeat(interval time.Duration, maxMissed int) connOption {
+	return func(c *Conn) {
+		c.heartbeatInterval = interval
+		c.heartbeatMaxMissed = max(maxMissed, 1)
+	}
+}
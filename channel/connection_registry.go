@@ -2,10 +2,15 @@ package channel
 
 import (
 	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
+	"github.com/google/uuid"
 	"github.com/ksysoev/wasabi"
 )
 
@@ -16,20 +21,86 @@ const (
 	connectionLimt               = -1
 )
 
+var (
+	// ErrConnectionNotFound is error for connections that are not registered in the registry
+	ErrConnectionNotFound = errors.New("connection not found")
+	// ErrRegistryClosed is error for connections that are registered after the registry is closed
+	ErrRegistryClosed = errors.New("connection registry is closed")
+	// ErrConnectionLimitReached is error for connections that exceed the global or per-key connection limit
+	ErrConnectionLimitReached = errors.New("connection limit reached")
+)
+
+// ConnectionRegistrar is interface for connection registries that keep connections of channels
+// that don't use websockets, such connections are created by the channel and registered explicitly.
+type ConnectionRegistrar interface {
+	wasabi.ConnectionRegistry
+	Register(conn wasabi.Connection) error
+	Unregister(conn wasabi.Connection)
+}
+
+// ConnectionIDGenerator is implemented by connection registries that generate ids of connections.
+// Channels that create connections before registering them take ids from it,
+// so the ids follow the registry configuration, e.g. the node prefix in cluster mode.
+type ConnectionIDGenerator interface {
+	NewConnectionID() string
+}
+
+// newConnectionID returns id for the new connection of the registrar, it's a random UUID
+// if the registrar doesn't generate ids.
+func newConnectionID(registrar ConnectionRegistrar) string {
+	if generator, ok := registrar.(ConnectionIDGenerator); ok {
+		return generator.NewConnectionID()
+	}
+
+	return uuid.New().String()
+}
+
 type ConnectionHook func(wasabi.Connection)
 
+// DisconnectHook is called after the connection is closed with the close info of the connection,
+// it tells the close status and reason, the side that initiated the close and the underlying error.
+type DisconnectHook func(conn wasabi.Connection, info *wasabi.CloseInfo)
+
 // ConnectionRegistry is default implementation of ConnectionRegistry
 type ConnectionRegistry struct {
-	connections       map[string]wasabi.Connection
-	bufferPool        *bufferPool
+	connections       *connMap
+	bufferPool        BufferPool
+	topics            *connGroups
+	indexes           *connGroups
+	idGenerator       func() string
+	keyLimiter        *keyLimiter
+	keyFunc           ConnectionKeyFunc
+	partitionKey      PartitionKeyFunc
+	sessions          *sessionStore
+	closed            chan struct{}
+	cluster           atomic.Pointer[clusterMembership]
 	onConnect         ConnectionHook
-	onDisconnect      ConnectionHook
+	onDisconnect      DisconnectHook
+	drainMessage      []byte
 	concurrencyLimit  uint
 	connectionLimit   int
+	keyLimitStatus    int
+	drainMsgType      wasabi.MessageType
+	keyLimitCloseCode websocket.StatusCode
 	frameSizeLimit    int64
+	streamReadLimit   int64
 	inActivityTimeout time.Duration
-	mu                sync.RWMutex
-	isClosed          bool
+	heartbeatInterval time.Duration
+	heartbeatMissed   int
+	sendQueueSize     int
+	sendQueueTimeout  time.Duration
+	drainWindow       time.Duration
+	readIdleTimeout   time.Duration
+	writeIdleTimeout  time.Duration
+	maxLifetime       time.Duration
+	lifetimeJitter    time.Duration
+	messageRate       rateLimit
+	bandwidth         rateLimit
+	limitAction       LimitAction
+	isClosed          atomic.Bool
+	sendQueuePolicy   OverflowPolicy
+	orderedProcessing bool
+	poisonPayloads    bool
 }
 
 type ConnectionRegistryOption func(*ConnectionRegistry)
@@ -37,12 +108,16 @@ type ConnectionRegistryOption func(*ConnectionRegistry)
 // NewConnectionRegistry creates new instance of ConnectionRegistry
 func NewConnectionRegistry(opts ...ConnectionRegistryOption) *ConnectionRegistry {
 	reg := &ConnectionRegistry{
-		connections:      make(map[string]wasabi.Connection),
-		concurrencyLimit: concurencyLimitPerConnection,
-		bufferPool:       newBufferPool(),
-		frameSizeLimit:   frameSizeLimitInBytes,
-		isClosed:         false,
-		connectionLimit:  connectionLimt,
+		connections:       newConnMap(),
+		closed:            make(chan struct{}),
+		concurrencyLimit:  concurencyLimitPerConnection,
+		bufferPool:        NewSizeClassBufferPool(),
+		topics:            newConnGroups(),
+		indexes:           newConnGroups(),
+		frameSizeLimit:    frameSizeLimitInBytes,
+		connectionLimit:   connectionLimt,
+		keyLimitStatus:    http.StatusTooManyRequests,
+		keyLimitCloseCode: websocket.StatusTryAgainLater,
 	}
 
 	for _, opt := range opts {
@@ -58,29 +133,83 @@ func (r *ConnectionRegistry) HandleConnection(
 	ws *websocket.Conn,
 	cb wasabi.OnMessage,
 ) {
-	r.mu.RLock()
-	isClosed := r.isClosed
-	numOfConnections := len(r.connections)
-	r.mu.RUnlock()
+	r.handleConnection(ctx, ws, cb, r.frameSizeLimit)
+}
+
+// HandleStreamConnection adds new Websocket connection to registry in streaming mode.
+// Incoming messages are passed to cb as readers while they arrive, instead of being buffered in memory.
+// The size of a single message is limited by the stream read limit, see WithStreamReadLimit.
+func (r *ConnectionRegistry) HandleStreamConnection(
+	ctx context.Context,
+	ws *websocket.Conn,
+	cb wasabi.OnMessageStream,
+) {
+	readLimit := r.streamReadLimit
+	if readLimit == 0 {
+		readLimit = r.frameSizeLimit
+	}
+
+	r.handleConnection(ctx, ws, nil, readLimit, withStreamHandler(cb))
+}
 
-	if isClosed {
+// handleConnection serves the websocket connection until it's closed.
+func (r *ConnectionRegistry) handleConnection(
+	ctx context.Context,
+	ws *websocket.Conn,
+	cb wasabi.OnMessage,
+	readLimit int64,
+	opts ...connOption,
+) {
+	if r.isClosed.Load() {
 		ws.Close(websocket.StatusServiceRestart, "Server is shutting down")
 		return
 	}
 
-	if r.connectionLimit > 0 && numOfConnections >= r.connectionLimit {
+	// The limit is checked before the connection is created to reject connections cheaply,
+	// and it's enforced atomically when the connection is added.
+	if r.connectionLimit > 0 && r.connections.len() >= r.connectionLimit {
 		ws.Close(websocket.StatusTryAgainLater, "Connection limit reached")
 		return
 	}
 
-	conn := NewConnection(ctx, ws, cb, r.bufferPool, r.concurrencyLimit, r.inActivityTimeout)
-	conn.ws.SetReadLimit(r.frameSizeLimit)
+	if r.keyLimiter != nil {
+		key := connectionKeyFromContext(ctx)
+
+		if !r.keyLimiter.acquire(key) {
+			ws.Close(r.keyLimitCloseCode, "Connection limit per key reached")
+			return
+		}
+
+		defer r.keyLimiter.release(key)
+	}
+
+	conn := r.newConnection(ctx, ws, cb, opts...)
+	conn.ws.SetReadLimit(readLimit)
 
 	id := conn.ID()
 
-	r.mu.Lock()
-	r.connections[id] = conn
-	r.mu.Unlock()
+	if !r.connections.add(id, conn, r.connectionLimit) {
+		_ = conn.Close(websocket.StatusTryAgainLater, "Connection limit reached")
+
+		if resumed, _ := wasabi.GetAttr[bool](conn, AttrSessionResumed); resumed {
+			// The client can retry to resume the session while it's within the grace period.
+			r.sessions.suspend(conn.session)
+		} else {
+			r.cleanupConnection(id)
+		}
+
+		return
+	}
+
+	// The registry could be closed while we were adding the connection,
+	// in this case Close may have missed it, so we need to revert the registration.
+	if r.isClosed.Load() {
+		r.connections.compareAndDelete(id, conn)
+		_ = conn.Close(websocket.StatusServiceRestart, "Server is shutting down")
+		r.cleanupConnection(id)
+
+		return
+	}
 
 	if r.onConnect != nil {
 		r.onConnect(conn)
@@ -88,71 +217,555 @@ func (r *ConnectionRegistry) HandleConnection(
 
 	conn.handleRequests()
 
-	r.mu.Lock()
-	connection := r.connections[id]
-	delete(r.connections, id)
-	r.mu.Unlock()
+	connection := r.connections.delete(id)
+
+	if conn.session != nil && !r.isClosed.Load() && resumableClose(conn.CloseInfo()) {
+		// Subscriptions and index keys are kept while the session is suspended,
+		// messages sent through them are buffered for replay.
+		r.sessions.suspend(conn.session)
+		conn.SetAttr(AttrSessionSuspended, true)
+	} else {
+		r.cleanupConnection(id)
+	}
 
 	if r.onDisconnect != nil {
-		r.onDisconnect(connection)
+		r.onDisconnect(connection, conn.CloseInfo())
+	}
+}
+
+// newConnection creates new connection for the websocket.
+// If session resumption is enabled, the connection resumes the suspended session from the handshake request,
+// or starts a new session if there is nothing to resume.
+func (r *ConnectionRegistry) newConnection(
+	ctx context.Context,
+	ws *websocket.Conn,
+	cb wasabi.OnMessage,
+	extra ...connOption,
+) *Conn {
+	opts := append(r.connOptions(), extra...)
+
+	if r.sessions == nil {
+		opts = append(opts, withID(r.NewConnectionID()))
+		return NewConnection(ctx, ws, cb, r.bufferPool, r.concurrencyLimit, r.inActivityTimeout, opts...)
+	}
+
+	var sess *session
+
+	req, ok := resumeRequestFromContext(ctx)
+	if ok {
+		sess = r.sessions.take(req.token)
+	}
+
+	if sess != nil {
+		opts = append(opts, withID(sess.connID))
+	} else {
+		opts = append(opts, withID(r.NewConnectionID()))
+	}
+
+	conn := NewConnection(ctx, ws, cb, r.bufferPool, r.concurrencyLimit, r.inActivityTimeout, opts...)
+
+	resumed := sess != nil && sess.attach(conn, req.lastSeq)
+
+	if !resumed {
+		if sess != nil {
+			// Missed messages are not available anymore, the client starts from scratch with a new session.
+			r.sessions.expire(sess)
+
+			conn.id = r.NewConnectionID()
+		}
+
+		sess = r.sessions.create(conn)
+	}
+
+	if resumed {
+		// Subscriptions and index keys kept for the suspended session point to the old connection.
+		r.topics.replace(conn)
+		r.indexes.replace(conn)
+	}
+
+	conn.session = sess
+	conn.SetAttr(AttrResumeToken, sess.token)
+	conn.SetAttr(AttrSessionResumed, resumed)
+	conn.SetAttr(AttrSessionSuspended, false)
+
+	return conn
+}
+
+// cleanupConnection removes all references to the connection with the given id.
+func (r *ConnectionRegistry) cleanupConnection(id string) {
+	if r.sessions != nil {
+		r.sessions.expireByID(id)
+	}
+
+	r.removeMemberships(id)
+}
+
+// removeMemberships removes connection with the given id from all topics and indexes.
+func (r *ConnectionRegistry) removeMemberships(id string) {
+	r.topics.removeAll(id)
+	r.indexes.removeAll(id)
+}
+
+// NewConnectionID generates id for the new connection, in cluster mode the id is prefixed with the node id.
+func (r *ConnectionRegistry) NewConnectionID() string {
+	var id string
+	if r.idGenerator != nil {
+		id = r.idGenerator()
+	} else {
+		id = uuid.New().String()
+	}
+
+	if c := r.cluster.Load(); c != nil {
+		return c.nodeID + clusterNodeSeparator + id
+	}
+
+	return id
+}
+
+// connOptions returns list of options for new connections based on the registry configuration.
+func (r *ConnectionRegistry) connOptions() []connOption {
+	opts := make([]connOption, 0)
+
+	if r.heartbeatInterval > 0 {
+		opts = append(opts, withHeartbeat(r.heartbeatInterval, r.heartbeatMissed))
 	}
+
+	if r.sendQueueSize > 0 {
+		opts = append(opts, withSendQueue(r.sendQueueSize, r.sendQueuePolicy, r.sendQueueTimeout))
+	}
+
+	if r.orderedProcessing {
+		opts = append(opts, withOrderedProcessing(r.partitionKey))
+	}
+
+	if r.poisonPayloads {
+		opts = append(opts, withPayloadPoisoning())
+	}
+
+	if r.readIdleTimeout > 0 || r.writeIdleTimeout > 0 {
+		opts = append(opts, withIdleTimeouts(r.readIdleTimeout, r.writeIdleTimeout))
+	}
+
+	if r.maxLifetime > 0 {
+		lifetime := r.maxLifetime
+		if r.lifetimeJitter > 0 {
+			lifetime += rand.N(r.lifetimeJitter)
+		}
+
+		opts = append(opts, withMaxLifetime(lifetime))
+	}
+
+	if r.messageRate.rate > 0 || r.bandwidth.rate > 0 {
+		opts = append(opts, withInboundLimits(r.messageRate, r.bandwidth, r.limitAction))
+	}
+
+	return opts
 }
 
 // CanAccept checks if the connection registry can accept new connections.
 // It returns true if the registry can accept new connections, and false otherwise.
+// It doesn't take any locks, so it's cheap to call on every handshake.
 func (r *ConnectionRegistry) CanAccept() bool {
+	if r.isClosed.Load() {
+		return false
+	}
+
 	if r.connectionLimit <= 0 {
 		return true
 	}
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	return r.connections.len() < r.connectionLimit
+}
+
+// AcceptRequest checks per-key connection limit for the handshake request.
+// It returns the request with the connection key in the context to continue the handshake with,
+// or the HTTP status to reject the request with if the limit for the key is reached.
+// The limit is enforced again when the connection is registered,
+// connections that exceed it at that point are closed with the configured close code.
+func (r *ConnectionRegistry) AcceptRequest(req *http.Request) (*http.Request, int) {
+	if r.keyLimiter == nil {
+		return req, 0
+	}
+
+	key := r.keyFunc(req)
+
+	if r.keyLimitStatus > 0 && !r.keyLimiter.canAcquire(key) {
+		return nil, r.keyLimitStatus
+	}
+
+	return req.WithContext(withConnectionKey(req.Context(), key)), 0
+}
+
+// KeyConnections returns number of active connections for the per-key limit key.
+func (r *ConnectionRegistry) KeyConnections(key string) int {
+	if r.keyLimiter == nil {
+		return 0
+	}
 
-	return len(r.connections) < r.connectionLimit
+	return r.keyLimiter.count(key)
+}
+
+// KeyConnectionCounts returns number of active connections for every per-key limit key with active connections.
+func (r *ConnectionRegistry) KeyConnectionCounts() map[string]int {
+	if r.keyLimiter == nil {
+		return map[string]int{}
+	}
+
+	return r.keyLimiter.snapshot()
+}
+
+// Register adds the connection created by a non-websocket channel to the registry and calls the OnConnect hook.
+// The connection limits are enforced, the per-key limit uses the connection key from the context of the connection.
+// The connection must be removed with Unregister when it's closed.
+func (r *ConnectionRegistry) Register(conn wasabi.Connection) error {
+	id := conn.ID()
+	key := connectionKeyFromContext(conn.Context())
+
+	if r.isClosed.Load() {
+		return ErrRegistryClosed
+	}
+
+	if r.keyLimiter != nil && !r.keyLimiter.acquire(key) {
+		return ErrConnectionLimitReached
+	}
+
+	if !r.connections.add(id, conn, r.connectionLimit) {
+		r.releaseKey(key)
+		return ErrConnectionLimitReached
+	}
+
+	// The registry could be closed while we were adding the connection,
+	// in this case Close may have missed it, so we need to revert the registration.
+	if r.isClosed.Load() {
+		r.connections.compareAndDelete(id, conn)
+		r.releaseKey(key)
+
+		return ErrRegistryClosed
+	}
+
+	if r.onConnect != nil {
+		r.onConnect(conn)
+	}
+
+	return nil
+}
+
+// Unregister removes the connection registered with Register from the registry,
+// cleans up its subscriptions and index keys, and calls the OnDisconnect hook.
+func (r *ConnectionRegistry) Unregister(conn wasabi.Connection) {
+	id := conn.ID()
+
+	if !r.connections.compareAndDelete(id, conn) {
+		return
+	}
+
+	r.releaseKey(connectionKeyFromContext(conn.Context()))
+
+	r.cleanupConnection(id)
+
+	if r.onDisconnect != nil {
+		r.onDisconnect(conn, conn.CloseInfo())
+	}
+}
+
+// releaseKey releases the per-key limit slot of the connection key.
+func (r *ConnectionRegistry) releaseKey(key string) {
+	if r.keyLimiter != nil {
+		r.keyLimiter.release(key)
+	}
 }
 
 // GetConnection returns connection by id
+// If session resumption is enabled and the session of the connection is suspended,
+// it returns the disconnected connection, messages sent to it are buffered and replayed when the session is resumed.
 func (r *ConnectionRegistry) GetConnection(id string) wasabi.Connection {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	if conn, ok := r.connections.get(id); ok {
+		return conn
+	}
+
+	if r.sessions != nil {
+		if conn := r.sessions.suspended(id); conn != nil {
+			return conn
+		}
+	}
+
+	return nil
+}
+
+// Count returns number of active connections in the registry.
+func (r *ConnectionRegistry) Count() int {
+	return r.connections.len()
+}
+
+// Range calls fn sequentially for each active connection in the registry.
+// If fn returns false, Range stops the iteration.
+// Range iterates over a snapshot of connections, so fn can safely call other registry methods
+// or close connections, connections added during the iteration are not visited.
+func (r *ConnectionRegistry) Range(fn func(conn wasabi.Connection) bool) {
+	for _, conn := range r.snapshot() {
+		if !fn(conn) {
+			return
+		}
+	}
+}
+
+// Filter returns list of active connections for which fn returns true.
+func (r *ConnectionRegistry) Filter(fn func(conn wasabi.Connection) bool) []wasabi.Connection {
+	result := make([]wasabi.Connection, 0)
+
+	r.Range(func(conn wasabi.Connection) bool {
+		if fn(conn) {
+			result = append(result, conn)
+		}
 
-	return r.connections[id]
+		return true
+	})
+
+	return result
+}
+
+// snapshot returns list of active connections in the registry.
+func (r *ConnectionRegistry) snapshot() []wasabi.Connection {
+	return r.connections.snapshot()
+}
+
+// Subscribe subscribes connection with the given id to the topic.
+// It returns ErrConnectionNotFound if the connection is not registered in the registry.
+// Subscriptions are removed automatically when the connection is closed.
+func (r *ConnectionRegistry) Subscribe(id, topic string) error {
+	conn := r.GetConnection(id)
+	if conn == nil {
+		return ErrConnectionNotFound
+	}
+
+	r.topics.add(topic, conn)
+
+	// The connection could be removed while we were subscribing it,
+	// in this case cleanup is already done and we need to revert the subscription.
+	if r.GetConnection(id) == nil {
+		r.topics.remove(topic, id)
+		return ErrConnectionNotFound
+	}
+
+	return nil
+}
+
+// Unsubscribe unsubscribes connection with the given id from the topic.
+// It's a no-op if the connection is not subscribed to the topic.
+func (r *ConnectionRegistry) Unsubscribe(id, topic string) {
+	r.topics.remove(topic, id)
+}
+
+// Subscriptions returns list of topics the connection with the given id is subscribed to.
+func (r *ConnectionRegistry) Subscriptions(id string) []string {
+	return r.topics.groupsOf(id)
+}
+
+// Subscribers returns number of connections subscribed to the topic.
+func (r *ConnectionRegistry) Subscribers(topic string) int {
+	return r.topics.size(topic)
+}
+
+// Publish sends message to all connections subscribed to the topic.
+// Subscribers are collected under the topic lock, the message is sent after the lock is released,
+// so slow connections do not block subscription changes or other publishers.
+// In cluster mode the message is also published to the message bus for subscribers of other nodes.
+// It returns number of connections of this node the message was successfully sent to.
+func (r *ConnectionRegistry) Publish(topic string, msgType wasabi.MessageType, msg []byte) int {
+	if c := r.cluster.Load(); c != nil {
+		r.publishCluster(c, topic, msgType, msg)
+	}
+
+	return r.publishLocal(topic, msgType, msg)
+}
+
+// publishLocal sends message to connections of this node subscribed to the topic.
+func (r *ConnectionRegistry) publishLocal(topic string, msgType wasabi.MessageType, msg []byte) int {
+	sent := 0
+
+	for _, conn := range r.topics.get(topic) {
+		if err := conn.Send(msgType, msg); err != nil {
+			continue
+		}
+
+		sent++
+	}
+
+	return sent
+}
+
+// AddIndexKey attaches the index key to the connection with the given id,
+// so the connection can be found with GetConnectionsByKey.
+// Keys are arbitrary strings, such as user id, tenant or device, it's recommended to prefix them with their kind,
+// e.g. "user:42", to avoid collisions. A connection can have any number of keys.
+// It returns ErrConnectionNotFound if the connection is not registered in the registry.
+// Keys are removed automatically when the connection is closed.
+func (r *ConnectionRegistry) AddIndexKey(id, key string) error {
+	conn := r.GetConnection(id)
+	if conn == nil {
+		return ErrConnectionNotFound
+	}
+
+	r.indexes.add(key, conn)
+
+	// The connection could be removed while we were indexing it,
+	// in this case cleanup is already done and we need to revert the index key.
+	if r.GetConnection(id) == nil {
+		r.indexes.remove(key, id)
+		return ErrConnectionNotFound
+	}
+
+	return nil
+}
+
+// RemoveIndexKey detaches the index key from the connection with the given id.
+// It's a no-op if the connection doesn't have the key.
+func (r *ConnectionRegistry) RemoveIndexKey(id, key string) {
+	r.indexes.remove(key, id)
+}
+
+// IndexKeys returns list of index keys attached to the connection with the given id.
+func (r *ConnectionRegistry) IndexKeys(id string) []string {
+	return r.indexes.groupsOf(id)
+}
+
+// GetConnectionsByKey returns all connections with the given index key.
+func (r *ConnectionRegistry) GetConnectionsByKey(key string) []wasabi.Connection {
+	return r.indexes.get(key)
 }
 
 // Shutdown closes all connections in the ConnectionRegistry.
 // It sets the isClosed flag to true, indicating that the registry is closed.
 // It then iterates over all connections, closes them with the given context,
 // and waits for all closures to complete before returning.
+// If the drain window is set, connections are closed one by one spread over the window with random jitter,
+// so clients don't reconnect to the remaining nodes at the same instant.
+// The window is shortened to fit the deadline of the closing context.
+// If the drain message is set, it's sent to every connection as soon as the drain starts.
+// Only the first call drains the registry, later calls wait for it to finish or for their closing context to be done.
 func (r *ConnectionRegistry) Close(ctx ...context.Context) error {
-	r.mu.Lock()
-	r.isClosed = true
-	connections := make([]wasabi.Connection, 0, len(r.connections))
+	if r.isClosed.Swap(true) {
+		var done <-chan struct{}
+		if len(ctx) > 0 {
+			done = ctx[0].Done()
+		}
+
+		select {
+		case <-r.closed:
+		case <-done:
+		}
 
-	for _, conn := range r.connections {
-		connections = append(connections, conn)
+		return nil
 	}
 
-	r.mu.Unlock()
+	defer close(r.closed)
+
+	connections := r.connections.snapshot()
+
+	delays := r.drainDelays(len(connections), ctx...)
 
 	wg := sync.WaitGroup{}
 
-	for _, conn := range connections {
-		c := conn
+	for i, conn := range connections {
+		c, delay := conn, delays[i]
 
 		wg.Add(1)
 
 		go func() {
 			defer wg.Done()
 
+			if r.drainMessage != nil {
+				_ = c.Send(r.drainMsgType, r.drainMessage)
+			}
+
+			waitDrainDelay(delay, ctx...)
+
 			c.Close(websocket.StatusServiceRestart, "", ctx...)
 		}()
 	}
 
 	wg.Wait()
 
+	if r.sessions != nil {
+		r.sessions.expireAll()
+	}
+
+	if c := r.cluster.Swap(nil); c != nil {
+		c.leave()
+	}
+
 	return nil
 }
 
+// drainDelays returns delays before closing each of n connections.
+// The drain window is split into n equal slots, and every connection is closed at a random moment of its slot.
+func (r *ConnectionRegistry) drainDelays(n int, ctx ...context.Context) []time.Duration {
+	delays := make([]time.Duration, n)
+
+	window := r.drainWindow
+
+	if len(ctx) > 0 {
+		if deadline, ok := ctx[0].Deadline(); ok {
+			window = min(window, time.Until(deadline))
+		}
+	}
+
+	if window <= 0 || n == 0 {
+		return delays
+	}
+
+	slot := window / time.Duration(n)
+
+	for i := range delays {
+		delays[i] = time.Duration(i) * slot
+
+		if slot > 0 {
+			delays[i] += rand.N(slot)
+		}
+	}
+
+	return delays
+}
+
+// waitDrainDelay waits for the delay, or until the closing context is done.
+func waitDrainDelay(delay time.Duration, ctx ...context.Context) {
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	if len(ctx) == 0 {
+		<-timer.C
+		return
+	}
+
+	select {
+	case <-timer.C:
+	case <-ctx[0].Done():
+	}
+}
+
+// WithDrainWindow sets the window over which connections are closed when the registry is closed.
+// Instead of closing all connections at once, they are closed one by one at random moments within the window,
+// so clients reconnect to the remaining nodes gradually. New connections are not accepted during the drain.
+// The window is shortened to fit the deadline of the context passed to Close.
+func WithDrainWindow(window time.Duration) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.drainWindow = window
+	}
+}
+
+// WithDrainMessage sets the application message that is sent to every connection when the registry starts closing,
+// e.g. to tell clients to reconnect soon. The connection is closed later according to the drain window.
+func WithDrainMessage(msgType wasabi.MessageType, msg []byte) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.drainMsgType = msgType
+		r.drainMessage = msg
+	}
+}
+
 // WithMaxFrameLimit sets the maximum frame size limit for incomming messages to the ConnectionRegistry.
 // The limit parameter specifies the maximum frame size limit in bytes.
 // This option can be used when creating a new ConnectionRegistry instance.
@@ -165,6 +778,34 @@ func WithMaxFrameLimit(limit int64) ConnectionRegistryOption {
 	}
 }
 
+// WithStreamReadLimit sets the maximum size of incoming messages for connections in streaming mode.
+// Streamed messages are not kept in memory, so the limit can be much larger than the frame size limit.
+// By default, the frame size limit is used, if the limit is set to -1, the size of streamed messages is not limited.
+// When the limit is exceeded, the connection is closed with status 1009 (message too large).
+func WithStreamReadLimit(limit int64) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.streamReadLimit = limit
+	}
+}
+
+// WithBufferPool sets the pool of buffers that are used to read incoming messages.
+// By default, the registry uses SizeClassBufferPool with default settings,
+// a custom pool can be used to tune size classes and retention limits for high-throughput deployments.
+func WithBufferPool(pool BufferPool) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.bufferPool = pool
+	}
+}
+
+// WithPayloadPoisoning enables the debug mode that overwrites message payloads when their buffers are returned to the pool.
+// Handlers that keep using the payload after the callback returns without wasabi.RetainPayload read garbage,
+// and with the race detector enabled the access is reported as a data race. It's meant for tests, not for production.
+func WithPayloadPoisoning() ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.poisonPayloads = true
+	}
+}
+
 // WithConcurrencyLimit sets the maximum number of concurrent requests that can be handled by a connection.
 // The default concurrency limit is 25.
 // When the concurrency limit is exceeded, the connection stops reading messages until the number of concurrent requests decreases.
@@ -174,6 +815,29 @@ func WithConcurrencyLimit(limit uint) ConnectionRegistryOption {
 	}
 }
 
+// WithOrderedProcessing makes connections process messages strictly in the order they were received.
+// By default, every message is processed concurrently in its own goroutine,
+// so two messages from the same client can reach the backend out of order.
+// In ordered mode, the next message of the connection is dispatched only after the previous one is processed.
+// The concurrency limit still applies, it limits the number of messages read ahead and waiting to be processed.
+func WithOrderedProcessing() ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.orderedProcessing = true
+		r.partitionKey = nil
+	}
+}
+
+// WithPartitionedProcessing makes connections process messages with the same partition key
+// strictly in the order they were received, while messages with different keys are processed concurrently.
+// The partition key is extracted from every message with keyFunc, and it's scoped to the connection.
+// The concurrency limit still applies to the total number of messages in progress per connection.
+func WithPartitionedProcessing(keyFunc PartitionKeyFunc) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.orderedProcessing = true
+		r.partitionKey = keyFunc
+	}
+}
+
 // WithInActivityTimeout sets the inactivity timeout for the connection.
 // The default inactivity timeout is 0 seconds, which means the timeout is disabled.
 // When the inactivity timeout is enabled, the connection is closed if there are no messages received within the specified duration.
@@ -183,6 +847,165 @@ func WithInActivityTimeout(timeout time.Duration) ConnectionRegistryOption {
 	}
 }
 
+// WithReadIdleTimeout sets the timeout for incoming messages, the connection is closed with status 1001 (going away)
+// if it doesn't receive any message within the timeout. Unlike WithInActivityTimeout,
+// messages sent to the client don't reset it, so a client that only receives pushes is still treated as idle.
+// The timeout is disabled by default.
+func WithReadIdleTimeout(timeout time.Duration) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.readIdleTimeout = timeout
+	}
+}
+
+// WithWriteIdleTimeout sets the timeout for outgoing messages, the connection is closed with status 1001 (going away)
+// if nothing is sent to the client within the timeout. Messages received from the client don't reset it.
+// The timeout is disabled by default.
+func WithWriteIdleTimeout(timeout time.Duration) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.writeIdleTimeout = timeout
+	}
+}
+
+// WithMaxLifetime sets the maximum lifetime of connections, after that the connection is closed
+// with status 1001 (going away), so clients reconnect periodically. It lets long-lived connections
+// rebalance across nodes and pick up rotated credentials.
+// Every connection gets a random extra time up to jitter, so connections established at the same time,
+// e.g. after a deploy, don't reconnect all at once.
+// The lifetime is not limited by default.
+func WithMaxLifetime(lifetime, jitter time.Duration) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.maxLifetime = lifetime
+		r.lifetimeJitter = jitter
+	}
+}
+
+// WithHeartbeat enables WebSocket ping/pong heartbeat for connections.
+// The ping frame is sent to the client every interval, and the connection waits for the pong up to the same interval.
+// When maxMissed consecutive pongs are missed, the peer is considered dead and the connection is terminated
+// without waiting for the closing handshake.
+// The round-trip time of the last successful ping can be read with Conn.RTT.
+// Heartbeat is disabled by default, and it works independently from the inactivity timeout,
+// pings and pongs do not reset the inactivity timer.
+func WithHeartbeat(interval time.Duration, maxMissed int) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.heartbeatInterval = interval
+		r.heartbeatMissed = maxMissed
+	}
+}
+
+// WithMessageRateLimit limits the rate of incoming messages per connection to perSecond messages per second,
+// with bursts of up to burst messages. The limit is enforced by the connection before messages are dispatched,
+// so messages over the limit never reach the dispatcher and its middlewares.
+// What happens when the limit is exceeded is defined by WithRateLimitAction.
+// The limit is disabled by default.
+func WithMessageRateLimit(perSecond float64, burst int) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.messageRate = rateLimit{rate: perSecond, burst: burst}
+	}
+}
+
+// WithBandwidthLimit limits the bandwidth of incoming messages per connection to bytesPerSecond bytes per second,
+// with bursts of up to burst bytes. A single message larger than the burst is allowed once the bucket is full,
+// but it's charged in full, so the following messages are delayed or rejected accordingly.
+// What happens when the limit is exceeded is defined by WithRateLimitAction.
+// The limit is disabled by default.
+func WithBandwidthLimit(bytesPerSecond float64, burst int) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.bandwidth = rateLimit{rate: bytesPerSecond, burst: burst}
+	}
+}
+
+// WithRateLimitAction sets what happens when a connection exceeds the message rate or bandwidth limit:
+//   - LimitActionDelay delays the message and reading of the following messages until the connection is within the limits.
+//   - LimitActionClose closes the connection with status 1008 (policy violation).
+//
+// The default action is LimitActionDelay.
+func WithRateLimitAction(action LimitAction) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.limitAction = action
+	}
+}
+
+// WithSendQueue enables bounded outgoing message queue for connections.
+// When the queue is enabled, Send copies the message to the queue and returns immediately,
+// and the messages are written to the client by a dedicated writer goroutine of the connection,
+// so a slow client does not block the sender.
+// The policy defines what happens when the queue is full:
+//   - OverflowBlock waits for free space up to the timeout and returns ErrSendTimeout, zero timeout means waiting without limit.
+//   - OverflowDropOldest drops the oldest queued message.
+//   - OverflowDropNewest drops the message being sent and returns ErrMessageDropped.
+//   - OverflowClose closes the connection with status 1008 (policy violation) and returns ErrConnectionClosed.
+//
+// The queue depth and the number of dropped messages can be read with Conn.QueueLen and Conn.DroppedMessages.
+// The send queue is disabled by default.
+func WithSendQueue(size int, policy OverflowPolicy, timeout time.Duration) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.sendQueueSize = size
+		r.sendQueuePolicy = policy
+		r.sendQueueTimeout = timeout
+	}
+}
+
+// WithSessionResumption enables session resumption for connections.
+// Every connection gets a session with a resume token, available in the AttrResumeToken connection attribute,
+// the application is responsible for passing the token to the client, for example in the onConnect hook.
+// Outgoing messages of the session are numbered sequentially starting from 1,
+// and the last bufferSize messages are kept in the replay buffer.
+// When the connection is lost, the session is suspended for the grace period, messages sent to it are buffered,
+// and its topic subscriptions and index keys are kept. Sessions of connections closed deliberately by the server,
+// e.g. with Close or for a policy violation, are expired right away and can't be resumed.
+// The client resumes the session by reconnecting with the resume_token and last_seq query parameters,
+// where last_seq is the number of messages it has received in the session.
+// The resumed connection keeps the id and the attributes of the original one, and missed messages are replayed to it.
+// If missed messages are not in the buffer anymore, a new session is started.
+// Hooks can check the AttrSessionResumed attribute in onConnect and the AttrSessionSuspended attribute in onDisconnect.
+func WithSessionResumption(gracePeriod time.Duration, bufferSize int) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.sessions = newSessionStore(gracePeriod, bufferSize, func(s *session) {
+			r.removeMemberships(s.connID)
+		})
+	}
+}
+
+// WithConnectionLimitPerKey sets the maximum number of concurrent connections per key.
+// The key is extracted from the handshake request with keyFunc, e.g. ClientIPKey limits connections per client IP.
+// Connections with an empty key are not limited. If keyFunc is nil, ClientIPKey is used.
+// By default, handshake requests over the limit are rejected with status 429 (too many requests),
+// this can be changed with WithKeyLimitRejection.
+// Current counters can be read with KeyConnections and KeyConnectionCounts.
+func WithConnectionLimitPerKey(limit int, keyFunc ConnectionKeyFunc) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		if keyFunc == nil {
+			keyFunc = ClientIPKey
+		}
+
+		r.keyLimiter = newKeyLimiter(limit)
+		r.keyFunc = keyFunc
+	}
+}
+
+// WithKeyLimitRejection sets how connections over the per-key limit are rejected.
+// If httpStatus is positive, the handshake request is rejected with this HTTP status.
+// If httpStatus is 0, the connection is upgraded and closed right away with the closeCode,
+// which lets browser clients see the reason of the rejection.
+// The closeCode is also used when the limit is reached between the handshake and the registration of the connection.
+// The defaults are 429 (too many requests) and 1013 (try again later).
+func WithKeyLimitRejection(httpStatus int, closeCode websocket.StatusCode) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.keyLimitStatus = httpStatus
+		r.keyLimitCloseCode = closeCode
+	}
+}
+
+// WithConnectionIDGenerator sets the function that generates ids for new connections.
+// By default, connection ids are random UUIDs.
+// The generator must return unique ids, and it can be called concurrently from multiple goroutines.
+func WithConnectionIDGenerator(generator func() string) ConnectionRegistryOption {
+	return func(r *ConnectionRegistry) {
+		r.idGenerator = generator
+	}
+}
+
 // WithOnConnectHook sets the connection hook function that will be called when a new connection is established.
 // The provided callback function `cb` will be invoked with the newly established connection as its argument.
 // This function returns a ConnectionRegistryOption that can be used to configure a ConnectionRegistry.
@@ -193,9 +1016,10 @@ func WithOnConnectHook(cb ConnectionHook) ConnectionRegistryOption {
 }
 
 // WithOnDisconnectHook sets the callback function to be executed when a connection is disconnected.
-// The provided callback function should have the signature `func(connectionID string)`.
+// The callback receives the connection and its close info, so a normal client close can be told apart
+// from an inactivity timeout, a too large message, a server shutdown or a close by a handler.
 // It can be used to perform any necessary cleanup or logging operations when a connection is disconnected.
-func WithOnDisconnectHook(cb ConnectionHook) ConnectionRegistryOption {
+func WithOnDisconnectHook(cb DisconnectHook) ConnectionRegistryOption {
 	return func(r *ConnectionRegistry) {
 		r.onDisconnect = cb
 	}
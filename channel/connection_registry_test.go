@@ -2,12 +2,21 @@ package channel
 
 import (
 	"context"
+	"io"
+	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/coder/websocket"
 	"github.com/ksysoev/wasabi"
+	whttp "github.com/ksysoev/wasabi/middleware/http"
 	"github.com/ksysoev/wasabi/mocks"
 )
 
@@ -53,7 +62,7 @@ func TestConnectionRegistry_HandleConnection(t *testing.T) {
 		t.Error("Expected connection to be handled")
 	}
 
-	if len(registry.connections) != 1 {
+	if registry.connections.len() != 1 {
 		t.Error("Expected connection to be added to the registry")
 	}
 
@@ -109,7 +118,7 @@ func TestConnectionRegistry_GetConnection(t *testing.T) {
 	conn := mocks.NewMockConnection(t)
 	conn.EXPECT().ID().Return("testID")
 
-	registry.connections[conn.ID()] = conn
+	registry.connections.add(conn.ID(), conn, 0)
 
 	result := registry.GetConnection(conn.ID())
 
@@ -140,8 +149,8 @@ func TestConnectionRegistry_Shutdown(t *testing.T) {
 	conn1.EXPECT().ID().Return("conn1")
 	conn2.EXPECT().ID().Return("conn2")
 
-	registry.connections[conn1.ID()] = conn1
-	registry.connections[conn2.ID()] = conn2
+	registry.connections.add(conn1.ID(), conn1, 0)
+	registry.connections.add(conn2.ID(), conn2, 0)
 
 	// Set up expectations for the Close method
 	conn1.EXPECT().Close(websocket.StatusServiceRestart, "", ctx).Return(nil)
@@ -153,7 +162,7 @@ func TestConnectionRegistry_Shutdown(t *testing.T) {
 	}
 
 	// Verify that the registry is closed
-	if !registry.isClosed {
+	if !registry.isClosed.Load() {
 		t.Error("Expected registry to be closed")
 	}
 }
@@ -249,11 +258,15 @@ func TestConnectionRegistry_WithOnDisconnectHook(t *testing.T) {
 	}
 
 	done := make(chan struct{})
-	hook := func(conn wasabi.Connection) {
+	hook := func(conn wasabi.Connection, info *wasabi.CloseInfo) {
 		if conn == nil {
 			t.Error("Expected connection to be passed to onDisconnect hook")
 		}
 
+		if info == nil {
+			t.Error("Expected close info to be passed to onDisconnect hook")
+		}
+
 		close(done)
 	}
 
@@ -324,8 +337,8 @@ func TestConnectionRegistry_AddConnection_ConnectionLimitReached(t *testing.T) {
 	conn1.EXPECT().ID().Return("conn1")
 	conn2.EXPECT().ID().Return("conn2")
 
-	registry.connections[conn1.ID()] = conn1
-	registry.connections[conn2.ID()] = conn2
+	registry.connections.add(conn1.ID(), conn1, 0)
+	registry.connections.add(conn2.ID(), conn2, 0)
 
 	ctx := context.Background()
 	cb := func(wasabi.Connection, wasabi.MessageType, []byte) {}
@@ -357,11 +370,134 @@ func TestConnectionRegistry_AddConnection_ConnectionLimitReached(t *testing.T) {
 		t.Error("Expected connection to be handled")
 	}
 
-	if len(registry.connections) != 2 {
+	if registry.connections.len() != 2 {
 		t.Error("Expected connection to not be added to the registry")
 	}
 }
 
+func TestConnectionRegistry_HandleConnection_ConcurrentLimit(t *testing.T) {
+	const clients = 2
+
+	var generated atomic.Int32
+
+	passed := make(chan struct{})
+
+	// Ids are generated after the early limit check, so both connections pass it before either is added.
+	registry := NewConnectionRegistry(
+		WithConnectionLimit(1),
+		WithConnectionIDGenerator(func() string {
+			n := generated.Add(1)
+			if n == clients {
+				close(passed)
+			}
+
+			select {
+			case <-passed:
+			case <-time.After(time.Second):
+			}
+
+			return "conn" + strconv.Itoa(int(n))
+		}),
+	)
+	defer func() { _ = registry.Close() }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		registry.HandleConnection(context.Background(), ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+	}))
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	var (
+		wg       sync.WaitGroup
+		rejected atomic.Int32
+	)
+
+	for range clients {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ws, resp, err := websocket.Dial(context.Background(), url, nil)
+			if err != nil {
+				t.Errorf("Unexpected error dialing websocket: %v", err)
+				return
+			}
+
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+
+			defer func() { _ = ws.CloseNow() }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			if _, _, err := ws.Read(ctx); websocket.CloseStatus(err) == websocket.StatusTryAgainLater {
+				rejected.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got := rejected.Load(); got != 1 {
+		t.Errorf("Expected 1 connection to be rejected, but got %d", got)
+	}
+
+	if registry.Count() != 1 {
+		t.Errorf("Expected 1 connection in the registry, but got %d", registry.Count())
+	}
+}
+
+func TestConnectionRegistry_HandleConnection_ClosedWhileAdding(t *testing.T) {
+	var registry *ConnectionRegistry
+
+	// Ids are generated after the registry is checked, so the registry is closed before the connection is added.
+	registry = NewConnectionRegistry(WithConnectionIDGenerator(func() string {
+		_ = registry.Close()
+		return "conn1"
+	}))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		registry.HandleConnection(context.Background(), ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+	}))
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, _, err := ws.Read(ctx); websocket.CloseStatus(err) != websocket.StatusServiceRestart {
+		t.Errorf("Expected connection to be closed with status %d, but got %v", websocket.StatusServiceRestart, err)
+	}
+
+	if registry.Count() != 0 {
+		t.Errorf("Expected no connections, but got %d", registry.Count())
+	}
+}
+
 func TestConnectionRegistry_CanAccept_ConnectionLimitNotSet(t *testing.T) {
 	registry := NewConnectionRegistry()
 
@@ -372,7 +508,7 @@ func TestConnectionRegistry_CanAccept_ConnectionLimitNotSet(t *testing.T) {
 	conn := mocks.NewMockConnection(t)
 	conn.EXPECT().ID().Return("conn1")
 
-	registry.connections[conn.ID()] = conn
+	registry.connections.add(conn.ID(), conn, 0)
 
 	if !registry.CanAccept() {
 		t.Error("Expected CanAccept to return true when connection limit is not set")
@@ -385,7 +521,7 @@ func TestConnectionRegistry_CanAccept_ConnectionLimitReached(t *testing.T) {
 	conn1 := mocks.NewMockConnection(t)
 	conn1.EXPECT().ID().Return("conn1")
 
-	registry.connections[conn1.ID()] = conn1
+	registry.connections.add(conn1.ID(), conn1, 0)
 
 	if !registry.CanAccept() {
 		t.Error("Expected CanAccept to return true when connection limit is reached")
@@ -393,9 +529,986 @@ func TestConnectionRegistry_CanAccept_ConnectionLimitReached(t *testing.T) {
 
 	conn2 := mocks.NewMockConnection(t)
 	conn2.EXPECT().ID().Return("conn2")
-	registry.connections[conn2.ID()] = conn2
+	registry.connections.add(conn2.ID(), conn2, 0)
 
 	if registry.CanAccept() {
 		t.Error("Expected CanAccept to return false when connection limit is reached")
 	}
 }
+
+func TestConnectionRegistry_Subscribe_ConnectionNotFound(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	if err := registry.Subscribe("unknown", "topic"); err != ErrConnectionNotFound {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionNotFound, err)
+	}
+
+	if registry.Subscribers("topic") != 0 {
+		t.Error("Expected topic to have no subscribers")
+	}
+}
+
+func TestConnectionRegistry_Publish(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	conn1 := mocks.NewMockConnection(t)
+	conn2 := mocks.NewMockConnection(t)
+	conn3 := mocks.NewMockConnection(t)
+
+	conn1.EXPECT().ID().Return("conn1")
+	conn2.EXPECT().ID().Return("conn2")
+	conn3.EXPECT().ID().Return("conn3")
+
+	registry.connections.add(conn1.ID(), conn1, 0)
+	registry.connections.add(conn2.ID(), conn2, 0)
+	registry.connections.add(conn3.ID(), conn3, 0)
+
+	for _, id := range []string{"conn1", "conn2"} {
+		if err := registry.Subscribe(id, "prices"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := registry.Subscribe("conn3", "news"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	msg := []byte("tick")
+
+	conn1.EXPECT().Send(wasabi.MsgTypeText, msg).Return(nil)
+	conn2.EXPECT().Send(wasabi.MsgTypeText, msg).Return(ErrConnectionClosed)
+
+	if sent := registry.Publish("prices", wasabi.MsgTypeText, msg); sent != 1 {
+		t.Errorf("Expected message to be sent to 1 connection, but got %d", sent)
+	}
+
+	if sent := registry.Publish("unknown", wasabi.MsgTypeText, msg); sent != 0 {
+		t.Errorf("Expected message to be sent to 0 connections, but got %d", sent)
+	}
+}
+
+func TestConnectionRegistry_Unsubscribe(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().ID().Return("conn1")
+
+	registry.connections.add(conn.ID(), conn, 0)
+
+	_ = registry.Subscribe("conn1", "topic1")
+	_ = registry.Subscribe("conn1", "topic2")
+
+	if topics := registry.Subscriptions("conn1"); len(topics) != 2 {
+		t.Errorf("Expected connection to be subscribed to 2 topics, but got %v", topics)
+	}
+
+	registry.Unsubscribe("conn1", "topic1")
+	registry.Unsubscribe("conn1", "unknown")
+
+	topics := registry.Subscriptions("conn1")
+	if len(topics) != 1 || topics[0] != "topic2" {
+		t.Errorf("Expected connection to be subscribed only to topic2, but got %v", topics)
+	}
+
+	if registry.Subscribers("topic1") != 0 {
+		t.Error("Expected topic1 to have no subscribers")
+	}
+}
+
+func TestConnectionRegistry_HandleConnection_RemovesSubscriptions(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Errorf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	var registry *ConnectionRegistry
+
+	subscribed := make(chan struct{})
+
+	registry = NewConnectionRegistry(WithOnConnectHook(func(conn wasabi.Connection) {
+		if err := registry.Subscribe(conn.ID(), "topic"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		close(subscribed)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		registry.HandleConnection(ctx, ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+		close(done)
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be subscribed")
+	}
+
+	if registry.Subscribers("topic") != 1 {
+		t.Errorf("Expected topic to have 1 subscriber, but got %d", registry.Subscribers("topic"))
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be closed")
+	}
+
+	if registry.Subscribers("topic") != 0 {
+		t.Errorf("Expected subscriptions to be removed, but topic has %d subscribers", registry.Subscribers("topic"))
+	}
+}
+
+func TestConnectionRegistry_Count(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	if registry.Count() != 0 {
+		t.Errorf("Expected registry to be empty, but got %d connections", registry.Count())
+	}
+
+	conn1 := mocks.NewMockConnection(t)
+	conn2 := mocks.NewMockConnection(t)
+
+	conn1.EXPECT().ID().Return("conn1")
+	conn2.EXPECT().ID().Return("conn2")
+
+	registry.connections.add(conn1.ID(), conn1, 0)
+	registry.connections.add(conn2.ID(), conn2, 0)
+
+	if registry.Count() != 2 {
+		t.Errorf("Expected registry to have 2 connections, but got %d", registry.Count())
+	}
+}
+
+func TestConnectionRegistry_Range(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	for _, id := range []string{"conn1", "conn2", "conn3"} {
+		conn := mocks.NewMockConnection(t)
+		registry.connections.add(id, conn, 0)
+	}
+
+	visited := 0
+
+	registry.Range(func(_ wasabi.Connection) bool {
+		visited++
+		return true
+	})
+
+	if visited != 3 {
+		t.Errorf("Expected 3 connections to be visited, but got %d", visited)
+	}
+
+	visited = 0
+
+	registry.Range(func(_ wasabi.Connection) bool {
+		visited++
+		return false
+	})
+
+	if visited != 1 {
+		t.Errorf("Expected iteration to stop after 1 connection, but got %d", visited)
+	}
+}
+
+func TestConnectionRegistry_Filter(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	for _, id := range []string{"user1-conn1", "user1-conn2", "user2-conn1"} {
+		conn := mocks.NewMockConnection(t)
+		conn.EXPECT().ID().Return(id)
+		registry.connections.add(id, conn, 0)
+	}
+
+	result := registry.Filter(func(conn wasabi.Connection) bool {
+		return strings.HasPrefix(conn.ID(), "user1-")
+	})
+
+	if len(result) != 2 {
+		t.Errorf("Expected 2 connections to match the filter, but got %d", len(result))
+	}
+
+	for _, conn := range result {
+		if !strings.HasPrefix(conn.ID(), "user1-") {
+			t.Errorf("Unexpected connection in the result: %s", conn.ID())
+		}
+	}
+}
+
+func TestConnectionRegistry_WithHeartbeat(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	if registry.heartbeatInterval != 0 {
+		t.Errorf("Unexpected heartbeat interval: got %v, expected %v", registry.heartbeatInterval, 0)
+	}
+
+	if len(registry.connOptions()) != 0 {
+		t.Error("Expected no connection options when heartbeat is disabled")
+	}
+
+	registry = NewConnectionRegistry(WithHeartbeat(30*time.Second, 3))
+
+	if registry.heartbeatInterval != 30*time.Second {
+		t.Errorf("Unexpected heartbeat interval: got %v, expected %v", registry.heartbeatInterval, 30*time.Second)
+	}
+
+	if registry.heartbeatMissed != 3 {
+		t.Errorf("Unexpected max missed pongs: got %d, expected %d", registry.heartbeatMissed, 3)
+	}
+
+	if len(registry.connOptions()) != 1 {
+		t.Error("Expected heartbeat connection option to be set")
+	}
+}
+
+func TestConnectionRegistry_WithSendQueue(t *testing.T) {
+	registry := NewConnectionRegistry(WithSendQueue(100, OverflowDropOldest, time.Second))
+
+	if registry.sendQueueSize != 100 {
+		t.Errorf("Unexpected send queue size: got %d, expected %d", registry.sendQueueSize, 100)
+	}
+
+	if registry.sendQueuePolicy != OverflowDropOldest {
+		t.Errorf("Unexpected overflow policy: got %d, expected %d", registry.sendQueuePolicy, OverflowDropOldest)
+	}
+
+	if registry.sendQueueTimeout != time.Second {
+		t.Errorf("Unexpected send queue timeout: got %v, expected %v", registry.sendQueueTimeout, time.Second)
+	}
+}
+
+func TestConnectionRegistry_WithOrderedProcessing(t *testing.T) {
+	registry := NewConnectionRegistry(WithOrderedProcessing())
+
+	if !registry.orderedProcessing {
+		t.Error("Expected ordered processing to be enabled")
+	}
+
+	if registry.partitionKey != nil {
+		t.Error("Expected partition key func to be nil")
+	}
+
+	registry = NewConnectionRegistry(WithPartitionedProcessing(func(_ wasabi.MessageType, data []byte) string {
+		return string(data[:1])
+	}))
+
+	if !registry.orderedProcessing {
+		t.Error("Expected ordered processing to be enabled")
+	}
+
+	if registry.partitionKey == nil {
+		t.Fatal("Expected partition key func to be set")
+	}
+
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0, registry.connOptions()...)
+
+	if conn.executor == nil {
+		t.Error("Expected connection to use ordered executor")
+	}
+
+	if key := conn.partitionKey(wasabi.MsgTypeText, []byte("abc")); key != "a" {
+		t.Errorf("Unexpected partition key: got %s, expected %s", key, "a")
+	}
+}
+
+func TestConnectionRegistry_AddIndexKey(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	if err := registry.AddIndexKey("unknown", "user:1"); err != ErrConnectionNotFound {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionNotFound, err)
+	}
+
+	for _, id := range []string{"conn1", "conn2", "conn3"} {
+		conn := mocks.NewMockConnection(t)
+		conn.EXPECT().ID().Return(id)
+		registry.connections.add(id, conn, 0)
+	}
+
+	_ = registry.AddIndexKey("conn1", "user:1")
+	_ = registry.AddIndexKey("conn2", "user:1")
+	_ = registry.AddIndexKey("conn2", "tenant:acme")
+	_ = registry.AddIndexKey("conn3", "user:2")
+
+	if conns := registry.GetConnectionsByKey("user:1"); len(conns) != 2 {
+		t.Errorf("Expected 2 connections for user:1, but got %d", len(conns))
+	}
+
+	if keys := registry.IndexKeys("conn2"); len(keys) != 2 {
+		t.Errorf("Expected connection to have 2 index keys, but got %v", keys)
+	}
+
+	registry.RemoveIndexKey("conn2", "user:1")
+
+	conns := registry.GetConnectionsByKey("user:1")
+	if len(conns) != 1 || conns[0].ID() != "conn1" {
+		t.Errorf("Expected only conn1 to have user:1 key, but got %v", conns)
+	}
+
+	if conns := registry.GetConnectionsByKey("unknown"); len(conns) != 0 {
+		t.Errorf("Expected no connections for unknown key, but got %d", len(conns))
+	}
+}
+
+func TestConnectionRegistry_WithConnectionIDGenerator(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Errorf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	var registry *ConnectionRegistry
+
+	connected := make(chan struct{})
+
+	registry = NewConnectionRegistry(
+		WithConnectionIDGenerator(func() string { return "node1-42" }),
+		WithOnConnectHook(func(conn wasabi.Connection) {
+			if conn.ID() != "node1-42" {
+				t.Errorf("Expected generated connection id, but got %s", conn.ID())
+			}
+
+			if err := registry.AddIndexKey(conn.ID(), "user:1"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			close(connected)
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		registry.HandleConnection(ctx, ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+		close(done)
+	}()
+
+	select {
+	case <-connected:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be established")
+	}
+
+	if conns := registry.GetConnectionsByKey("user:1"); len(conns) != 1 {
+		t.Errorf("Expected 1 connection for user:1, but got %d", len(conns))
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be closed")
+	}
+
+	if conns := registry.GetConnectionsByKey("user:1"); len(conns) != 0 {
+		t.Errorf("Expected index keys to be removed, but got %d connections", len(conns))
+	}
+}
+
+func TestConnectionRegistry_AcceptRequest(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+
+	if got, status := registry.AcceptRequest(req); got != req || status != 0 {
+		t.Errorf("Expected request to be accepted without per-key limit, but got status %d", status)
+	}
+
+	registry = NewConnectionRegistry(WithConnectionLimitPerKey(1, func(r *http.Request) string {
+		return r.Header.Get("X-Client")
+	}))
+
+	req.Header.Set("X-Client", "client1")
+
+	got, status := registry.AcceptRequest(req)
+	if status != 0 {
+		t.Fatalf("Expected request to be accepted, but got status %d", status)
+	}
+
+	if key := connectionKeyFromContext(got.Context()); key != "client1" {
+		t.Errorf("Expected connection key to be client1, but got %q", key)
+	}
+
+	registry.keyLimiter.acquire("client1")
+
+	if _, status := registry.AcceptRequest(req); status != http.StatusTooManyRequests {
+		t.Errorf("Expected request to be rejected with status %d, but got %d", http.StatusTooManyRequests, status)
+	}
+
+	if registry.KeyConnections("client1") != 1 {
+		t.Errorf("Expected 1 connection for client1, but got %d", registry.KeyConnections("client1"))
+	}
+
+	if counts := registry.KeyConnectionCounts(); len(counts) != 1 || counts["client1"] != 1 {
+		t.Errorf("Unexpected connection counts: %v", counts)
+	}
+
+	// With rejection by close code, the handshake is not rejected
+	registry = NewConnectionRegistry(
+		WithConnectionLimitPerKey(1, func(r *http.Request) string { return r.Header.Get("X-Client") }),
+		WithKeyLimitRejection(0, websocket.StatusPolicyViolation),
+	)
+	registry.keyLimiter.acquire("client1")
+
+	if _, status := registry.AcceptRequest(req); status != 0 {
+		t.Errorf("Expected request to be accepted, but got status %d", status)
+	}
+}
+
+func TestConnectionRegistry_WithConnectionLimitPerKey_NilKeyFunc(t *testing.T) {
+	registry := NewConnectionRegistry(WithConnectionLimitPerKey(1, nil))
+
+	var req *http.Request
+
+	handler := whttp.NewClientIPMiddleware(whttp.NotProvided)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		req = r
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com", http.NoBody)
+	r.RemoteAddr = "192.0.2.1:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	got, status := registry.AcceptRequest(req)
+	if status != 0 {
+		t.Fatalf("Expected request to be accepted, but got status %d", status)
+	}
+
+	if key := connectionKeyFromContext(got.Context()); key != "192.0.2.1" {
+		t.Errorf("Expected connection key to be client IP, but got %q", key)
+	}
+}
+
+func TestConnectionRegistry_HandleConnection_KeyLimitReached(t *testing.T) {
+	registry := NewConnectionRegistry(
+		WithConnectionLimitPerKey(1, ClientIPKey),
+		WithKeyLimitRejection(0, websocket.StatusPolicyViolation),
+	)
+
+	registry.keyLimiter.acquire("10.0.0.1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		registry.HandleConnection(withConnectionKey(context.Background(), "10.0.0.1"), ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+	}))
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, _, err = ws.Read(ctx)
+	if status := websocket.CloseStatus(err); status != websocket.StatusPolicyViolation {
+		t.Errorf("Expected connection to be closed with status %d, but got %d (%v)", websocket.StatusPolicyViolation, status, err)
+	}
+
+	if registry.Count() != 0 {
+		t.Error("Expected connection to not be added to the registry")
+	}
+
+	if registry.KeyConnections("10.0.0.1") != 1 {
+		t.Errorf("Expected counter to stay unchanged, but got %d", registry.KeyConnections("10.0.0.1"))
+	}
+}
+
+func TestConnectionRegistry_HandleStreamConnection(t *testing.T) {
+	// The message is larger than the frame size limit, but it fits into the stream read limit
+	payload := strings.Repeat("a", 64*1024)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = c.CloseNow() }()
+
+		if err := c.Write(r.Context(), websocket.MessageText, []byte(payload)); err != nil {
+			return
+		}
+
+		_, _, _ = c.Read(r.Context())
+	}))
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	received := make(chan int, 1)
+	cb := func(_ wasabi.Connection, _ wasabi.MessageType, r io.Reader) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("Unexpected error reading stream: %v", err)
+		}
+
+		received <- len(data)
+	}
+
+	registry := NewConnectionRegistry(WithMaxFrameLimit(1024), WithStreamReadLimit(1024*1024))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+
+	go func() {
+		registry.HandleStreamConnection(ctx, ws, cb)
+		close(done)
+	}()
+
+	select {
+	case n := <-received:
+		if n != len(payload) {
+			t.Errorf("Unexpected message size: got %d, expected %d", n, len(payload))
+		}
+	case <-time.After(1 * time.Second):
+		t.Error("Expected message to be streamed")
+	}
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Error("Expected connection to be closed")
+	}
+}
+
+func TestConnectionRegistry_WithStreamReadLimit(t *testing.T) {
+	registry := NewConnectionRegistry(WithStreamReadLimit(-1))
+
+	if registry.streamReadLimit != -1 {
+		t.Errorf("Unexpected stream read limit: got %d, expected %d", registry.streamReadLimit, -1)
+	}
+}
+
+func TestConnectionRegistry_Close_Drain(t *testing.T) {
+	ctx := context.Background()
+	drainMsg := []byte(`{"type":"reconnect"}`)
+	registry := NewConnectionRegistry(
+		WithDrainWindow(200*time.Millisecond),
+		WithDrainMessage(wasabi.MsgTypeText, drainMsg),
+	)
+
+	var (
+		mu       sync.Mutex
+		closedAt []time.Duration
+	)
+
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		conn := mocks.NewMockConnection(t)
+		conn.EXPECT().Send(wasabi.MsgTypeText, drainMsg).Return(nil)
+		conn.EXPECT().Close(websocket.StatusServiceRestart, "", ctx).RunAndReturn(
+			func(websocket.StatusCode, string, ...context.Context) error {
+				mu.Lock()
+				closedAt = append(closedAt, time.Since(start))
+				mu.Unlock()
+
+				return nil
+			},
+		)
+
+		registry.connections.add("conn"+strconv.Itoa(i), conn, 0)
+	}
+
+	if err := registry.Close(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(closedAt) != 4 {
+		t.Fatalf("Expected 4 connections to be closed, but got %d", len(closedAt))
+	}
+
+	slices.Sort(closedAt)
+
+	if closedAt[len(closedAt)-1] < 150*time.Millisecond {
+		t.Errorf("Expected connection closes to be spread over the drain window, but the last one was closed after %v", closedAt[len(closedAt)-1])
+	}
+
+	if registry.CanAccept() {
+		t.Error("Expected registry not to accept new connections after drain")
+	}
+}
+
+func TestConnectionRegistry_Close_DrainDeadline(t *testing.T) {
+	registry := NewConnectionRegistry(WithDrainWindow(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().Close(websocket.StatusServiceRestart, "", ctx).Return(nil)
+
+	registry.connections.add("conn1", conn, 0)
+	registry.connections.add("conn2", conn, 0)
+
+	done := make(chan struct{})
+
+	go func() {
+		_ = registry.Close(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Error("Expected drain to finish before the context deadline")
+	}
+}
+
+func TestConnectionRegistry_Close_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	drainMsg := []byte(`{"type":"reconnect"}`)
+	registry := NewConnectionRegistry(
+		WithDrainWindow(100*time.Millisecond),
+		WithDrainMessage(wasabi.MsgTypeText, drainMsg),
+	)
+
+	var closed atomic.Bool
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().Send(wasabi.MsgTypeText, drainMsg).Return(nil).Once()
+	conn.EXPECT().Close(websocket.StatusServiceRestart, "", ctx).RunAndReturn(
+		func(websocket.StatusCode, string, ...context.Context) error {
+			closed.Store(true)
+			return nil
+		},
+	).Once()
+
+	registry.connections.add("conn1", conn, 0)
+
+	var wg sync.WaitGroup
+
+	for range 3 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := registry.Close(ctx); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if !closed.Load() {
+				t.Error("Expected Close to return after the drain is finished")
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestConnectionRegistry_drainDelays(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	for _, delay := range registry.drainDelays(3) {
+		if delay != 0 {
+			t.Errorf("Expected no delay without drain window, but got %v", delay)
+		}
+	}
+
+	registry = NewConnectionRegistry(WithDrainWindow(time.Second))
+	delays := registry.drainDelays(4)
+
+	for i, delay := range delays {
+		slotStart := time.Duration(i) * 250 * time.Millisecond
+		if delay < slotStart || delay >= slotStart+250*time.Millisecond {
+			t.Errorf("Expected delay %d to be within its slot, but got %v", i, delay)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	for _, delay := range registry.drainDelays(4, ctx) {
+		if delay >= 100*time.Millisecond {
+			t.Errorf("Expected delay to fit into the context deadline, but got %v", delay)
+		}
+	}
+}
+
+func TestConnectionRegistry_CanAccept_Closed(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	if !registry.CanAccept() {
+		t.Error("Expected registry to accept new connections")
+	}
+
+	_ = registry.Close()
+
+	if registry.CanAccept() {
+		t.Error("Expected closed registry not to accept new connections")
+	}
+}
+
+func TestConnectionRegistry_WithBufferPool(t *testing.T) {
+	pool := NewSizeClassBufferPool(WithSizeClasses(512))
+	registry := NewConnectionRegistry(WithBufferPool(pool))
+
+	if registry.bufferPool != pool {
+		t.Error("Expected registry to use the provided buffer pool")
+	}
+}
+
+func TestConnectionRegistry_WithPayloadPoisoning(t *testing.T) {
+	registry := NewConnectionRegistry(WithPayloadPoisoning())
+
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, registry.bufferPool, 1, 0, registry.connOptions()...)
+
+	if !conn.poisonPayloads {
+		t.Error("Expected connection to poison payloads")
+	}
+}
+
+func TestConnectionRegistry_Register(t *testing.T) {
+	var connected, disconnected []string
+
+	registry := NewConnectionRegistry(
+		WithConnectionLimit(1),
+		WithOnConnectHook(func(conn wasabi.Connection) { connected = append(connected, conn.ID()) }),
+		WithOnDisconnectHook(func(conn wasabi.Connection, _ *wasabi.CloseInfo) { disconnected = append(disconnected, conn.ID()) }),
+	)
+
+	conn1 := newSSEConn(context.Background(), "conn1", httptest.NewRecorder(), 0)
+	conn2 := newSSEConn(context.Background(), "conn2", httptest.NewRecorder(), 0)
+
+	if err := registry.Register(conn1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if registry.GetConnection(conn1.ID()) != conn1 {
+		t.Error("Expected connection to be registered")
+	}
+
+	if err := registry.Register(conn2); err != ErrConnectionLimitReached {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionLimitReached, err)
+	}
+
+	if err := registry.Subscribe(conn1.ID(), "topic"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Unregistering a connection that is not registered is a no-op
+	registry.Unregister(conn2)
+	registry.Unregister(conn1)
+
+	if registry.Count() != 0 {
+		t.Errorf("Expected no connections, but got %d", registry.Count())
+	}
+
+	if registry.Subscribers("topic") != 0 {
+		t.Error("Expected subscriptions to be removed")
+	}
+
+	if !slices.Equal(connected, []string{conn1.ID()}) {
+		t.Errorf("Unexpected connected hooks: %v", connected)
+	}
+
+	if !slices.Equal(disconnected, []string{conn1.ID()}) {
+		t.Errorf("Unexpected disconnected hooks: %v", disconnected)
+	}
+
+	_ = registry.Close()
+
+	if err := registry.Register(conn2); err != ErrRegistryClosed {
+		t.Errorf("Expected error %v, but got %v", ErrRegistryClosed, err)
+	}
+}
+
+func TestConnectionRegistry_WithRateLimits(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, registry.bufferPool, 1, 0, registry.connOptions()...)
+	if conn.limiter != nil {
+		t.Error("Expected rate limits to be disabled by default")
+	}
+
+	registry = NewConnectionRegistry(
+		WithMessageRateLimit(10, 20),
+		WithBandwidthLimit(1024, 4096),
+		WithRateLimitAction(LimitActionClose),
+	)
+
+	conn = NewConnection(context.Background(), &websocket.Conn{}, nil, registry.bufferPool, 1, 0, registry.connOptions()...)
+
+	if conn.limiter == nil {
+		t.Fatal("Expected connection to have rate limits")
+	}
+
+	if conn.limiter.action != LimitActionClose {
+		t.Errorf("Unexpected limit action: got %d, expected %d", conn.limiter.action, LimitActionClose)
+	}
+
+	if conn.limiter.messages.rate != 10 || conn.limiter.messages.burst != 20 {
+		t.Errorf("Unexpected message rate limit: %+v", conn.limiter.messages)
+	}
+
+	if conn.limiter.bytes.rate != 1024 || conn.limiter.bytes.burst != 4096 {
+		t.Errorf("Unexpected bandwidth limit: %+v", conn.limiter.bytes)
+	}
+}
+
+func TestConnectionRegistry_WithIdleTimeoutsAndMaxLifetime(t *testing.T) {
+	registry := NewConnectionRegistry()
+
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, registry.bufferPool, 1, 0, registry.connOptions()...)
+	if conn.readIdleTimeout != 0 || conn.writeIdleTimeout != 0 || conn.maxLifetime != 0 {
+		t.Error("Expected idle timeouts and max lifetime to be disabled by default")
+	}
+
+	registry = NewConnectionRegistry(
+		WithReadIdleTimeout(time.Minute),
+		WithWriteIdleTimeout(2*time.Minute),
+		WithMaxLifetime(time.Hour, 10*time.Minute),
+	)
+
+	for range 10 {
+		conn = NewConnection(context.Background(), &websocket.Conn{}, nil, registry.bufferPool, 1, 0, registry.connOptions()...)
+		conn.ctxCancel(nil)
+
+		if conn.readIdleTimeout != time.Minute {
+			t.Errorf("Unexpected read idle timeout: got %s, expected %s", conn.readIdleTimeout, time.Minute)
+		}
+
+		if conn.writeIdleTimeout != 2*time.Minute {
+			t.Errorf("Unexpected write idle timeout: got %s, expected %s", conn.writeIdleTimeout, 2*time.Minute)
+		}
+
+		if conn.maxLifetime < time.Hour || conn.maxLifetime >= time.Hour+10*time.Minute {
+			t.Errorf("Unexpected max lifetime: got %s, expected within jitter of %s", conn.maxLifetime, time.Hour)
+		}
+	}
+}
+
+// benchmarkConnections creates connections for every goroutine of b.RunParallel,
+// so goroutines register and unregister their own connections.
+func benchmarkConnections(perGoroutine int) [][]*Conn {
+	conns := make([][]*Conn, runtime.GOMAXPROCS(0))
+
+	for i := range conns {
+		conns[i] = make([]*Conn, perGoroutine)
+
+		for j := range conns[i] {
+			conns[i][j] = NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+		}
+	}
+
+	return conns
+}
+
+func BenchmarkConnectionRegistry_RegisterUnregister(b *testing.B) {
+	for _, existing := range []int{0, 100_000} {
+		b.Run("existing="+strconv.Itoa(existing), func(b *testing.B) {
+			registry := NewConnectionRegistry(WithConnectionLimit(existing + 1_000_000))
+
+			for i := range existing {
+				registry.connections.add("existing"+strconv.Itoa(i), nil, 0)
+			}
+
+			conns := benchmarkConnections(1024)
+
+			var next atomic.Int32
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				own := conns[int(next.Add(1)-1)%len(conns)]
+
+				for i := 0; pb.Next(); i++ {
+					conn := own[i%len(own)]
+
+					if err := registry.Register(conn); err != nil {
+						b.Errorf("Unexpected error registering connection: %v", err)
+						return
+					}
+
+					registry.Unregister(conn)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkConnectionRegistry_CanAccept(b *testing.B) {
+	registry := NewConnectionRegistry(WithConnectionLimit(1_000_000))
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if !registry.CanAccept() {
+				b.Error("Expected registry to accept connections")
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkConnectionRegistry_GetConnection(b *testing.B) {
+	registry := NewConnectionRegistry()
+	conns := benchmarkConnections(1024)
+
+	for _, own := range conns {
+		for _, conn := range own {
+			registry.connections.add(conn.ID(), conn, 0)
+		}
+	}
+
+	var next atomic.Int32
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		own := conns[int(next.Add(1)-1)%len(conns)]
+
+		for i := 0; pb.Next(); i++ {
+			if registry.GetConnection(own[i%len(own)].ID()) == nil {
+				b.Error("Expected connection to be found")
+				return
+			}
+		}
+	})
+}
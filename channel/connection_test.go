@@ -2,9 +2,12 @@ package channel
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -48,16 +51,20 @@ var wsHandlerEcho = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request
 
 func TestConn_ID(t *testing.T) {
 	ws := &websocket.Conn{}
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	if conn.ID() == "" {
 		t.Error("Expected connection ID to be non-empty")
 	}
+
+	if s := fmt.Sprint(conn); s != conn.ID() {
+		t.Errorf("Expected connection to be formatted as its ID %q, but got %q", conn.ID(), s)
+	}
 }
 
 func TestConn_Context(t *testing.T) {
 	ws := &websocket.Conn{}
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	if conn.Context() == nil {
 		t.Error("Expected connection context to be non-nil")
@@ -81,7 +88,7 @@ func TestConn_handleRequests(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	// Mock OnMessage callback
 	received := make(chan struct{})
@@ -121,7 +128,7 @@ func TestConn_Send(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	err = conn.Send(wasabi.MsgTypeText, []byte("test message"))
 	if err != nil {
@@ -146,7 +153,7 @@ func TestConn_close(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 	done := make(chan string)
 
 	go func() {
@@ -181,7 +188,7 @@ func TestConn_Close_PendingRequests(t *testing.T) {
 	defer func() { _ = ws.CloseNow() }()
 
 	ctx := context.Background()
-	c := NewConnection(ctx, ws, nil, newBufferPool(), 1, 0)
+	c := NewConnection(ctx, ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	done := make(chan struct{})
 
@@ -219,7 +226,7 @@ func TestConn_Close_NoContext(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	c := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 0)
+	c := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
 
 	done := make(chan struct{})
 
@@ -241,7 +248,7 @@ func TestConn_Close_NoContext(t *testing.T) {
 }
 
 func TestConn_Close_AlreadyClosed(t *testing.T) {
-	c := NewConnection(context.Background(), &websocket.Conn{}, nil, newBufferPool(), 1, 0)
+	c := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
 	c.state.Store(int32(terminated))
 
 	err := c.Close(websocket.StatusNormalClosure, "test reason", context.Background())
@@ -267,7 +274,7 @@ func TestConn_watchInactivity(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 10*time.Millisecond)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 10*time.Millisecond)
 
 	done := make(chan struct{})
 
@@ -307,7 +314,7 @@ func TestConn_watchInactivity_stopping_timer(t *testing.T) {
 
 	defer func() { _ = ws.CloseNow() }()
 
-	conn := NewConnection(context.Background(), ws, nil, newBufferPool(), 1, 10*time.Millisecond)
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 10*time.Millisecond)
 
 	ctxClose, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -324,3 +331,655 @@ func TestConn_watchInactivity_stopping_timer(t *testing.T) {
 		}
 	}
 }
+
+func TestConn_heartbeat(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Errorf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0, withHeartbeat(10*time.Millisecond, 1))
+
+	go conn.handleRequests()
+
+	defer conn.close()
+
+	deadline := time.After(1 * time.Second)
+
+	for conn.RTT() == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Expected round-trip time to be measured")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestConn_heartbeat_MissedPongs(t *testing.T) {
+	// Server never reads from the connection, so it never replies to pings
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer func() { _ = c.CloseNow() }()
+
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Errorf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0, withHeartbeat(10*time.Millisecond, 2))
+
+	go conn.handleRequests()
+
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be closed after missed pongs")
+	}
+
+	info := conn.CloseInfo()
+	if !errors.Is(info, ErrHeartbeatTimeout) {
+		t.Errorf("Expected close error %v, but got %v", ErrHeartbeatTimeout, info)
+	}
+
+	if msg := info.Error(); msg != "connection closed by server with status 1006: heartbeat timeout" {
+		t.Errorf("Unexpected close error message: %q", msg)
+	}
+
+	if conn.RTT() != 0 {
+		t.Errorf("Expected round-trip time to be 0, but got %v", conn.RTT())
+	}
+}
+
+func TestConn_heartbeat_BusyConnection(t *testing.T) {
+	// Server sends two messages and keeps reading, so it replies to pings
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer func() { _ = c.CloseNow() }()
+
+		ctx := c.CloseRead(r.Context())
+
+		for range 2 {
+			if err := c.Write(ctx, websocket.MessageText, []byte("slow")); err != nil {
+				return
+			}
+		}
+
+		<-ctx.Done()
+	}))
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	handled := make(chan struct{}, 2)
+	onMessage := func(_ wasabi.Connection, _ wasabi.MessageType, _ []byte) {
+		time.Sleep(300 * time.Millisecond)
+		handled <- struct{}{}
+	}
+
+	// The second message waits for the only concurrency slot, so the connection is not read for a while.
+	conn := NewConnection(context.Background(), ws, onMessage, NewSizeClassBufferPool(), 1, 0, withHeartbeat(50*time.Millisecond, 2))
+
+	go conn.handleRequests()
+
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	for range 2 {
+		select {
+		case <-handled:
+		case <-conn.Context().Done():
+			t.Fatalf("Expected busy connection to stay open, but it was closed: %v", conn.CloseInfo())
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected messages to be handled")
+		}
+	}
+
+	if conn.Context().Err() != nil {
+		t.Errorf("Expected busy connection to stay open, but it was closed: %v", conn.CloseInfo())
+	}
+}
+
+func TestConn_Attr(t *testing.T) {
+	ctx := wasabi.ContextWithAttrs(context.Background(), map[string]any{"user_id": 42, "tenant": "acme"})
+	conn := NewConnection(ctx, &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+
+	if userID, ok := wasabi.GetAttr[int](conn, "user_id"); !ok || userID != 42 {
+		t.Errorf("Expected user_id attribute to be 42, but got %v", userID)
+	}
+
+	if _, ok := wasabi.GetAttr[string](conn, "user_id"); ok {
+		t.Error("Expected typed lookup to fail for attribute of different type")
+	}
+
+	if _, ok := conn.Attr("unknown"); ok {
+		t.Error("Expected unknown attribute to be missing")
+	}
+
+	wasabi.SetAttr(conn, "tenant", "other")
+
+	if tenant, ok := wasabi.GetAttr[string](conn, "tenant"); !ok || tenant != "other" {
+		t.Errorf("Expected tenant attribute to be other, but got %v", tenant)
+	}
+}
+
+func TestConn_handleRequests_Ordered(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 10, 0, withOrderedProcessing(nil))
+
+	const total = 20
+
+	received := make(chan string, total)
+
+	conn.onMessageCB = func(_ wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		// earlier messages are slower, so they would be overtaken without ordering
+		if data[0] == '0' {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		received <- string(data)
+	}
+
+	go conn.handleRequests()
+
+	for i := 0; i < total; i++ {
+		err = ws.Write(context.Background(), websocket.MessageText, []byte(fmt.Sprintf("%02d", i)))
+		if err != nil {
+			t.Fatalf("Unexpected error sending message: %v", err)
+		}
+	}
+
+	for i := 0; i < total; i++ {
+		select {
+		case msg := <-received:
+			if expected := fmt.Sprintf("%02d", i); msg != expected {
+				t.Fatalf("Expected message %s, but got %s", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected OnMessage callback to be called")
+		}
+	}
+}
+
+func TestConn_Writer(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0)
+
+	w, err := conn.Writer(wasabi.MsgTypeText)
+	if err != nil {
+		t.Fatalf("Unexpected error creating writer: %v", err)
+	}
+
+	for _, part := range []string{"test ", "streamed ", "message"} {
+		if _, err := w.Write([]byte(part)); err != nil {
+			t.Fatalf("Unexpected error writing message: %v", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error closing writer: %v", err)
+	}
+
+	_, data, err := ws.Read(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error reading echo: %v", err)
+	}
+
+	if string(data) != "test streamed message" {
+		t.Errorf("Expected echo %q, but got %q", "test streamed message", string(data))
+	}
+
+	conn.close()
+
+	if _, err := conn.Writer(wasabi.MsgTypeText); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestConn_Writer_SendQueue(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := NewConnection(context.Background(), ws, nil, NewSizeClassBufferPool(), 1, 0, withSendQueue(10, OverflowBlock, 0))
+
+	w, err := conn.Writer(wasabi.MsgTypeText)
+	if err != nil {
+		t.Fatalf("Unexpected error creating writer: %v", err)
+	}
+
+	if _, ok := w.(*bufferedWriter); !ok {
+		t.Fatalf("Expected buffered writer with send queue, but got %T", w)
+	}
+
+	_, _ = w.Write([]byte("queued message"))
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error closing writer: %v", err)
+	}
+
+	_, data, err := ws.Read(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error reading echo: %v", err)
+	}
+
+	if string(data) != "queued message" {
+		t.Errorf("Expected echo %q, but got %q", "queued message", string(data))
+	}
+}
+
+func TestConn_handleRequests_RateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		action   LimitAction
+		received int
+		closed   bool
+	}{
+		{name: "delay", action: LimitActionDelay, received: 3},
+		{name: "close", action: LimitActionClose, received: 1, closed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(wsHandlerEcho)
+			defer server.Close()
+
+			ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error dialing websocket: %v", err)
+			}
+
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+
+			defer func() { _ = ws.CloseNow() }()
+
+			received := make(chan time.Time, 3)
+			onMessage := func(_ wasabi.Connection, _ wasabi.MessageType, _ []byte) {
+				received <- time.Now()
+			}
+
+			conn := NewConnection(
+				context.Background(), ws, onMessage, NewSizeClassBufferPool(), 10, 0,
+				withInboundLimits(rateLimit{rate: 20, burst: 1}, rateLimit{}, tt.action),
+			)
+
+			start := time.Now()
+
+			go conn.handleRequests()
+
+			for i := 0; i < 3; i++ {
+				if err := ws.Write(context.Background(), websocket.MessageText, []byte("test")); err != nil {
+					t.Fatalf("Unexpected error sending message: %v", err)
+				}
+			}
+
+			var last time.Time
+
+			for i := 0; i < tt.received; i++ {
+				select {
+				case last = <-received:
+				case <-time.After(time.Second):
+					t.Fatal("Expected OnMessage callback to be called")
+				}
+			}
+
+			if tt.closed {
+				select {
+				case <-conn.Context().Done():
+				case <-time.After(time.Second):
+					t.Fatal("Expected connection to be closed")
+				}
+
+				if len(received) != 0 {
+					t.Error("Expected messages over the limit not to be dispatched")
+				}
+
+				return
+			}
+
+			if elapsed := last.Sub(start); elapsed < 90*time.Millisecond {
+				t.Errorf("Expected messages over the limit to be delayed, but all were dispatched in %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestConn_CloseInfo(t *testing.T) {
+	tests := []struct {
+		expectedErr       error
+		handler           http.HandlerFunc
+		action            func(conn *Conn)
+		name              string
+		expectedReason    string
+		inActivityTimeout time.Duration
+		expectedCode      websocket.StatusCode
+		expectedInitiator wasabi.CloseInitiator
+	}{
+		{
+			name: "closed by client",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				ws, err := websocket.Accept(w, r, nil)
+				if err != nil {
+					return
+				}
+
+				_ = ws.Close(websocket.StatusNormalClosure, "bye")
+			},
+			expectedCode:      websocket.StatusNormalClosure,
+			expectedReason:    "bye",
+			expectedInitiator: wasabi.ClosedByClient,
+		},
+		{
+			name: "message too big",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				ws, err := websocket.Accept(w, r, nil)
+				if err != nil {
+					return
+				}
+
+				defer func() { _ = ws.CloseNow() }()
+
+				_ = ws.Write(r.Context(), websocket.MessageText, []byte(strings.Repeat("a", 100)))
+				_, _, _ = ws.Read(r.Context())
+			},
+			action: func(conn *Conn) {
+				conn.ws.SetReadLimit(10)
+			},
+			expectedCode:      websocket.StatusMessageTooBig,
+			expectedReason:    "message too big",
+			expectedErr:       websocket.ErrMessageTooBig,
+			expectedInitiator: wasabi.ClosedByServer,
+		},
+		{
+			name:    "closed by server",
+			handler: wsHandlerEcho,
+			action: func(conn *Conn) {
+				_ = conn.Close(websocket.StatusServiceRestart, "shutdown")
+			},
+			expectedCode:      websocket.StatusServiceRestart,
+			expectedReason:    "shutdown",
+			expectedInitiator: wasabi.ClosedByServer,
+		},
+		{
+			name:              "inactivity timeout",
+			handler:           wsHandlerEcho,
+			inActivityTimeout: 10 * time.Millisecond,
+			expectedCode:      websocket.StatusGoingAway,
+			expectedReason:    "inactivity timeout",
+			expectedErr:       ErrInactivityTimeout,
+			expectedInitiator: wasabi.ClosedByServer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error dialing websocket: %v", err)
+			}
+
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+
+			defer func() { _ = ws.CloseNow() }()
+
+			onMessage := func(_ wasabi.Connection, _ wasabi.MessageType, _ []byte) {}
+			conn := NewConnection(context.Background(), ws, onMessage, NewSizeClassBufferPool(), 1, tt.inActivityTimeout)
+
+			if conn.CloseInfo() != nil {
+				t.Error("Expected no close info for open connection")
+			}
+
+			done := make(chan struct{})
+
+			go func() {
+				conn.handleRequests()
+				close(done)
+			}()
+
+			if tt.action != nil {
+				tt.action(conn)
+			}
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("Expected connection to be closed")
+			}
+
+			info := conn.CloseInfo()
+			if info == nil {
+				t.Fatal("Expected close info for closed connection")
+			}
+
+			if info.Code != tt.expectedCode || info.Reason != tt.expectedReason || info.Initiator != tt.expectedInitiator {
+				t.Errorf("Unexpected close info: %+v", info)
+			}
+
+			if tt.expectedErr != nil && !errors.Is(info, tt.expectedErr) {
+				t.Errorf("Expected close error %v, but got %v", tt.expectedErr, info.Err)
+			}
+
+			if cause := context.Cause(conn.Context()); cause != info {
+				t.Errorf("Expected connection context to be canceled with close info, but got %v", cause)
+			}
+		})
+	}
+}
+
+func TestConn_watchTimeouts(t *testing.T) {
+	// silentHandler reads messages from the connection without replying.
+	silentHandler := func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer func() { _ = ws.CloseNow() }()
+
+		for {
+			if _, _, err := ws.Read(r.Context()); err != nil {
+				return
+			}
+		}
+	}
+
+	// chattyHandler keeps sending messages to the connection.
+	chattyHandler := func(w http.ResponseWriter, r *http.Request) {
+		ws, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer func() { _ = ws.CloseNow() }()
+
+		ctx := ws.CloseRead(r.Context())
+
+		for {
+			if err := ws.Write(ctx, websocket.MessageText, []byte("ping")); err != nil {
+				return
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	tests := []struct {
+		expectedErr    error
+		handler        http.HandlerFunc
+		name           string
+		expectedReason string
+		opts           []connOption
+		sendMessages   bool
+	}{
+		{
+			name:           "read idle timeout is not reset by sent messages",
+			handler:        silentHandler,
+			opts:           []connOption{withIdleTimeouts(30*time.Millisecond, 0)},
+			sendMessages:   true,
+			expectedReason: "read idle timeout",
+			expectedErr:    ErrReadIdleTimeout,
+		},
+		{
+			name:           "write idle timeout is not reset by received messages",
+			handler:        chattyHandler,
+			opts:           []connOption{withIdleTimeouts(0, 30*time.Millisecond)},
+			expectedReason: "write idle timeout",
+			expectedErr:    ErrWriteIdleTimeout,
+		},
+		{
+			name:           "max lifetime",
+			handler:        silentHandler,
+			opts:           []connOption{withIdleTimeouts(time.Second, time.Second), withMaxLifetime(30 * time.Millisecond)},
+			sendMessages:   true,
+			expectedReason: "max connection lifetime reached",
+			expectedErr:    ErrMaxLifetimeReached,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+			if err != nil {
+				t.Fatalf("Unexpected error dialing websocket: %v", err)
+			}
+
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+
+			defer func() { _ = ws.CloseNow() }()
+
+			onMessage := func(_ wasabi.Connection, _ wasabi.MessageType, _ []byte) {}
+			conn := NewConnection(context.Background(), ws, onMessage, NewSizeClassBufferPool(), 1, 0, tt.opts...)
+
+			done := make(chan struct{})
+
+			go func() {
+				conn.handleRequests()
+				close(done)
+			}()
+
+			ticker := time.NewTicker(5 * time.Millisecond)
+			defer ticker.Stop()
+
+			timeout := time.After(time.Second)
+
+		loop:
+			for {
+				select {
+				case <-done:
+					break loop
+				case <-ticker.C:
+					if tt.sendMessages {
+						_ = conn.Send(wasabi.MsgTypeText, []byte("push"))
+					}
+				case <-timeout:
+					t.Fatal("Expected connection to be closed")
+				}
+			}
+
+			info := conn.CloseInfo()
+			if info == nil {
+				t.Fatal("Expected close info for closed connection")
+			}
+
+			if info.Code != websocket.StatusGoingAway || info.Reason != tt.expectedReason || info.Initiator != wasabi.ClosedByServer {
+				t.Errorf("Unexpected close info: %+v", info)
+			}
+
+			if !errors.Is(info, tt.expectedErr) {
+				t.Errorf("Expected close error %v, but got %v", tt.expectedErr, info.Err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package channel
 
 import (
 	"context"
+	"io"
 
 	"github.com/coder/websocket"
 	"github.com/ksysoev/wasabi"
@@ -14,14 +15,18 @@ type WrapperOptions func(*ConnectionWrapper)
 // SendWrapper is a function type that wraps the Send method of a ConnectionWrapper.
 type SendWrapper func(conn wasabi.Connection, msgType wasabi.MessageType, msg []byte) error
 
+// WriterWrapper is a function type that wraps the Writer method of a ConnectionWrapper.
+type WriterWrapper func(conn wasabi.Connection, msgType wasabi.MessageType) (io.WriteCloser, error)
+
 // CloseWrapper is a function type that wraps the Close method of a ConnectionWrapper.
 type CloseWrapper func(conn wasabi.Connection, status websocket.StatusCode, reason string, closingCtx ...context.Context) error
 
 // ConnectionWrapper is a wrapper around a wasabi.Connection that allows for custom behavior to be applied to the connection.
 type ConnectionWrapper struct {
-	connection     wasabi.Connection
-	onSendWrapper  SendWrapper
-	onCloseWrapper CloseWrapper
+	connection      wasabi.Connection
+	onSendWrapper   SendWrapper
+	onWriterWrapper WriterWrapper
+	onCloseWrapper  CloseWrapper
 }
 
 // NewConnectionWrapper creates a new ConnectionWrapper instance with the given connection and options.
@@ -48,6 +53,27 @@ func (cw *ConnectionWrapper) Context() context.Context {
 	return cw.connection.Context()
 }
 
+// Attr returns value of the attribute with the given key from the underlying connection.
+func (cw *ConnectionWrapper) Attr(key string) (any, bool) {
+	return cw.connection.Attr(key)
+}
+
+// SetAttr sets value of the attribute with the given key on the underlying connection.
+func (cw *ConnectionWrapper) SetAttr(key string, value any) {
+	cw.connection.SetAttr(key, value)
+}
+
+// CloseInfo returns how and why the underlying connection was closed.
+func (cw *ConnectionWrapper) CloseInfo() *wasabi.CloseInfo {
+	return cw.connection.CloseInfo()
+}
+
+// RetainPayload keeps the payload of the incoming message of the underlying connection valid
+// until the returned release function is called.
+func (cw *ConnectionWrapper) RetainPayload(data []byte) (release func()) {
+	return wasabi.RetainPayload(cw.connection, data)
+}
+
 // Send sends a message of the specified type and content over the connection.
 // If an onSendWrapper function is set, it will be called instead of directly sending the message.
 // The onSendWrapper function should have the signature func(connection Connection, msgType MessageType, msg []byte) error.
@@ -61,6 +87,25 @@ func (cw *ConnectionWrapper) Send(msgType wasabi.MessageType, msg []byte) error
 	return cw.connection.Send(msgType, msg)
 }
 
+// Writer returns writer that streams a single message to the connection.
+// If an onWriterWrapper function is set, it will be called instead of directly creating the writer.
+// If only an onSendWrapper function is set, the message is collected in memory and passed to it when the writer is closed,
+// so send wrappers are applied to streamed messages as well.
+// Otherwise, the writer of the underlying connection is returned.
+func (cw *ConnectionWrapper) Writer(msgType wasabi.MessageType) (io.WriteCloser, error) {
+	if cw.onWriterWrapper != nil {
+		return cw.onWriterWrapper(cw.connection, msgType)
+	}
+
+	if cw.onSendWrapper != nil {
+		return newBufferedWriter(func(msg []byte) error {
+			return cw.onSendWrapper(cw.connection, msgType, msg)
+		}), nil
+	}
+
+	return cw.connection.Writer(msgType)
+}
+
 // Close closes the connection with the specified status code and reason.
 // It also accepts an optional closing context.
 // If an onCloseWrapper function is set, it will be called instead of directly closing the connection.
@@ -81,6 +126,14 @@ func WithSendWrapper(wrapper SendWrapper) WrapperOptions {
 	}
 }
 
+// WithWriterWrapper returns a WrapperOptions function that sets the onWriterWrapper
+// field of the ConnectionWrapper to the provided wrapper.
+func WithWriterWrapper(wrapper WriterWrapper) WrapperOptions {
+	return func(cw *ConnectionWrapper) {
+		cw.onWriterWrapper = wrapper
+	}
+}
+
 // WithCloseWrapper returns a WrapperOptions function that sets the onCloseWrapper
 // field of the ConnectionWrapper to the provided wrapper.
 func WithCloseWrapper(wrapper CloseWrapper) WrapperOptions {
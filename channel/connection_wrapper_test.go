@@ -2,6 +2,7 @@ package channel
 
 import (
 	"context"
+	"io"
 	"testing"
 
 	"github.com/coder/websocket"
@@ -157,3 +158,94 @@ func TestConnectionWrapper_WithCloseWrapper(t *testing.T) {
 		t.Error("Expected onCloseWrapper to be set")
 	}
 }
+
+func TestConnectionWrapper_Attr(t *testing.T) {
+	mockConnection := mocks.NewMockConnection(t)
+	wrapper := NewConnectionWrapper(mockConnection)
+
+	mockConnection.EXPECT().SetAttr("user_id", "42").Return()
+	mockConnection.EXPECT().Attr("user_id").Return("42", true)
+
+	wrapper.SetAttr("user_id", "42")
+
+	value, ok := wasabi.GetAttr[string](wrapper, "user_id")
+
+	assert.True(t, ok)
+	assert.Equal(t, "42", value)
+}
+
+func TestConnectionWrapper_Writer(t *testing.T) {
+	mockConnection := mocks.NewMockConnection(t)
+	wrapper := NewConnectionWrapper(mockConnection)
+
+	expectedWriter := newBufferedWriter(func([]byte) error { return nil })
+	mockConnection.EXPECT().Writer(wasabi.MsgTypeBinary).Return(expectedWriter, nil)
+
+	w, err := wrapper.Writer(wasabi.MsgTypeBinary)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedWriter, w)
+}
+
+func TestConnectionWrapper_Writer_WithOnSendWrapper(t *testing.T) {
+	mockConnection := mocks.NewMockConnection(t)
+
+	var sent []byte
+
+	wrapper := NewConnectionWrapper(mockConnection, WithSendWrapper(func(conn wasabi.Connection, msgType wasabi.MessageType, msg []byte) error {
+		assert.Equal(t, mockConnection, conn)
+		assert.Equal(t, wasabi.MsgTypeText, msgType)
+
+		sent = msg
+
+		return nil
+	}))
+
+	w, err := wrapper.Writer(wasabi.MsgTypeText)
+	assert.NoError(t, err)
+
+	_, _ = w.Write([]byte("test "))
+	_, _ = w.Write([]byte("message"))
+
+	assert.Nil(t, sent)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []byte("test message"), sent)
+}
+
+func TestConnectionWrapper_Writer_WithOnWriterWrapper(t *testing.T) {
+	mockConnection := mocks.NewMockConnection(t)
+	expectedWriter := newBufferedWriter(func([]byte) error { return nil })
+
+	wrapper := NewConnectionWrapper(mockConnection,
+		WithSendWrapper(func(wasabi.Connection, wasabi.MessageType, []byte) error { return nil }),
+		WithWriterWrapper(func(conn wasabi.Connection, msgType wasabi.MessageType) (io.WriteCloser, error) {
+			assert.Equal(t, mockConnection, conn)
+			assert.Equal(t, wasabi.MsgTypeText, msgType)
+
+			return expectedWriter, nil
+		}),
+	)
+
+	w, err := wrapper.Writer(wasabi.MsgTypeText)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedWriter, w)
+}
+
+func TestConnectionWrapper_RetainPayload(t *testing.T) {
+	pool := NewSizeClassBufferPool()
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, pool, 1, 0)
+	wrapper := NewConnectionWrapper(conn)
+
+	buffer := pool.Get(0)
+	buffer.WriteString("test")
+
+	key := conn.lendPayload(buffer)
+	release := wrapper.RetainPayload(buffer.Bytes())
+
+	conn.releasePayload(key, buffer)
+	assert.Len(t, conn.payloads, 1)
+
+	release()
+	assert.Empty(t, conn.payloads)
+}
@@ -0,0 +1,119 @@
+package channel
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	whttp "github.com/ksysoev/wasabi/middleware/http"
+)
+
+// ConnectionKeyFunc is a function type that extracts the key for per-key connection limits from the handshake request.
+// Connections with an empty key are not limited.
+type ConnectionKeyFunc func(r *http.Request) string
+
+// RequestAcceptor is implemented by connection registries that decide whether to accept a connection
+// based on the handshake request.
+// AcceptRequest returns the request to continue the handshake with, or the HTTP status to reject the request with.
+type RequestAcceptor interface {
+	AcceptRequest(r *http.Request) (*http.Request, int)
+}
+
+type connectionKeyCtx struct{}
+
+// ClientIPKey is a ConnectionKeyFunc that limits connections per client IP address.
+// The client IP is taken from the request context, so the channel should use the middleware
+// created with http.NewClientIPMiddleware from the middleware/http package.
+func ClientIPKey(r *http.Request) string {
+	return whttp.GetClientIP(r.Context())
+}
+
+// withConnectionKey returns a copy of the context with the connection key.
+func withConnectionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, connectionKeyCtx{}, key)
+}
+
+// connectionKeyFromContext returns the connection key stored in the context.
+func connectionKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(connectionKeyCtx{}).(string)
+	return key
+}
+
+// keyLimiter counts active connections per key and enforces the limit.
+type keyLimiter struct {
+	counts map[string]int
+	limit  int
+	mu     sync.Mutex
+}
+
+// newKeyLimiter creates new instance of keyLimiter
+func newKeyLimiter(limit int) *keyLimiter {
+	return &keyLimiter{
+		counts: make(map[string]int),
+		limit:  limit,
+	}
+}
+
+// canAcquire checks if there is a free slot for the key without acquiring it.
+func (l *keyLimiter) canAcquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return key == "" || l.counts[key] < l.limit
+}
+
+// acquire takes a slot for the key, it returns false if the limit for the key is reached.
+func (l *keyLimiter) acquire(key string) bool {
+	if key == "" {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[key] >= l.limit {
+		return false
+	}
+
+	l.counts[key]++
+
+	return true
+}
+
+// release frees a slot for the key.
+func (l *keyLimiter) release(key string) {
+	if key == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.counts[key]--
+
+	if l.counts[key] <= 0 {
+		delete(l.counts, key)
+	}
+}
+
+// count returns number of active connections for the key.
+func (l *keyLimiter) count(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.counts[key]
+}
+
+// snapshot returns copy of connection counts for all keys with active connections.
+func (l *keyLimiter) snapshot() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make(map[string]int, len(l.counts))
+
+	for key, count := range l.counts {
+		counts[key] = count
+	}
+
+	return counts
+}
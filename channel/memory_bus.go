@@ -0,0 +1,75 @@
+package channel
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryBus is in-memory implementation of wasabi.MessageBus.
+// It connects registries of the same process, so it's useful for tests and for running several nodes
+// in one process. Messages are delivered synchronously, Publish returns after all handlers of the subject return.
+type MemoryBus struct {
+	subjects map[string][]*memorySubscription
+	mu       sync.RWMutex
+}
+
+// memorySubscription is a subscription of MemoryBus.
+type memorySubscription struct {
+	handler func(data []byte)
+}
+
+// NewMemoryBus creates new instance of MemoryBus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		subjects: make(map[string][]*memorySubscription),
+	}
+}
+
+// Publish delivers the data to all subscribers of the subject.
+// Every subscriber gets its own copy of the data.
+func (b *MemoryBus) Publish(ctx context.Context, subject string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	subs := b.subjects[subject]
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.handler(slices.Clone(data))
+	}
+
+	return nil
+}
+
+// Subscribe registers the handler for the subject, it returns the function that removes the subscription.
+func (b *MemoryBus) Subscribe(subject string, handler func(data []byte)) (func(), error) {
+	sub := &memorySubscription{handler: handler}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Subscriptions are copied on write, so publishers can iterate them without holding the lock.
+	b.subjects[subject] = append(slices.Clip(b.subjects[subject]), sub)
+
+	return func() { b.unsubscribe(subject, sub) }, nil
+}
+
+// unsubscribe removes the subscription from the subject.
+func (b *MemoryBus) unsubscribe(subject string, sub *memorySubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := slices.DeleteFunc(slices.Clone(b.subjects[subject]), func(s *memorySubscription) bool {
+		return s == sub
+	})
+
+	if len(subs) == 0 {
+		delete(b.subjects, subject)
+		return
+	}
+
+	b.subjects[subject] = subs
+}
@@ -0,0 +1,50 @@
+package channel
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+
+	var got1, got2 []string
+
+	unsubscribe1, err := bus.Subscribe("subject", func(data []byte) { got1 = append(got1, string(data)) })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := bus.Subscribe("subject", func(data []byte) { got2 = append(got2, string(data)) }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := bus.Subscribe("other", func(_ []byte) { t.Error("Unexpected message for other subject") }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := bus.Publish(context.Background(), "subject", []byte("first")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	unsubscribe1()
+
+	if err := bus.Publish(context.Background(), "subject", []byte("second")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(got1) != 1 || got1[0] != "first" {
+		t.Errorf("Unexpected messages of the first subscriber: %v", got1)
+	}
+
+	if len(got2) != 2 || got2[0] != "first" || got2[1] != "second" {
+		t.Errorf("Unexpected messages of the second subscriber: %v", got2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := bus.Publish(ctx, "subject", []byte("canceled")); err == nil {
+		t.Error("Expected error for canceled context")
+	}
+}
@@ -0,0 +1,60 @@
+package channel
+
+import (
+	"sync"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// PartitionKeyFunc is a function type that extracts the partition key from the message.
+// Messages with the same partition key are processed sequentially in the order they were received,
+// messages with different keys are processed concurrently.
+type PartitionKeyFunc func(msgType wasabi.MessageType, data []byte) string
+
+// orderedExecutor runs tasks sequentially per key, while tasks with different keys run concurrently.
+// A worker goroutine is started for a key when the first task is submitted, and it exits when the queue of the key is empty.
+type orderedExecutor struct {
+	queues map[string][]func()
+	mu     sync.Mutex
+}
+
+// newOrderedExecutor creates new instance of orderedExecutor
+func newOrderedExecutor() *orderedExecutor {
+	return &orderedExecutor{
+		queues: make(map[string][]func()),
+	}
+}
+
+// submit puts the task to the queue of the key.
+func (e *orderedExecutor) submit(key string, task func()) {
+	e.mu.Lock()
+	queue, running := e.queues[key]
+	e.queues[key] = append(queue, task)
+	e.mu.Unlock()
+
+	if !running {
+		go e.run(key)
+	}
+}
+
+// run executes tasks from the queue of the key until the queue is empty.
+func (e *orderedExecutor) run(key string) {
+	for {
+		e.mu.Lock()
+		queue := e.queues[key]
+
+		if len(queue) == 0 {
+			delete(e.queues, key)
+			e.mu.Unlock()
+
+			return
+		}
+
+		task := queue[0]
+		queue[0] = nil
+		e.queues[key] = queue[1:]
+		e.mu.Unlock()
+
+		task()
+	}
+}
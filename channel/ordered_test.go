@@ -0,0 +1,91 @@
+package channel
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrderedExecutor_KeepsOrderPerKey(t *testing.T) {
+	executor := newOrderedExecutor()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		got []int
+	)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		executor.submit("key", func() {
+			defer wg.Done()
+
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		})
+	}
+
+	wg.Wait()
+
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("Expected task %d at position %d, but got %d", i, i, v)
+		}
+	}
+
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	if len(executor.queues) != 0 {
+		t.Errorf("Expected no queues after all tasks are done, but got %d", len(executor.queues))
+	}
+}
+
+func TestOrderedExecutor_RunsKeysConcurrently(t *testing.T) {
+	executor := newOrderedExecutor()
+	blocked := make(chan struct{})
+	done := make(chan struct{})
+
+	executor.submit("slow", func() { <-blocked })
+	executor.submit("fast", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Expected task with another key not to wait for the blocked one")
+	}
+
+	close(blocked)
+}
+
+func TestOrderedExecutor_ConcurrentSubmit(t *testing.T) {
+	executor := newOrderedExecutor()
+
+	var wg sync.WaitGroup
+
+	counts := make([]int, 10)
+
+	for k := range counts {
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+
+			go executor.submit(strconv.Itoa(k), func() {
+				defer wg.Done()
+
+				// tasks of the same key never run concurrently, so no locking is needed
+				counts[k]++
+			})
+		}
+	}
+
+	wg.Wait()
+
+	for k, count := range counts {
+		if count != 50 {
+			t.Errorf("Expected 50 tasks for key %d, but got %d", k, count)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package channel
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// OriginChecker reports whether the handshake request with the given Origin header is allowed.
+// It's called only for requests with Origin header, requests without it are sent by non-browser clients
+// and are not subject to cross-origin checks.
+type OriginChecker func(r *http.Request, origin string) bool
+
+// OriginAllowList is a list of allowed origin patterns that can be changed at runtime,
+// e.g. when white-label domains are added. It's safe for concurrent use,
+// handshakes read the current list without locking.
+//
+// Patterns are matched the same way as with WithOriginPatterns: a pattern without scheme is matched
+// against the host of the origin, a pattern with scheme is matched against scheme and host,
+// matching is case-insensitive and uses path.Match syntax. Origins with the same host as the request are always allowed.
+type OriginAllowList struct {
+	patterns atomic.Pointer[[]string]
+	mu       sync.Mutex
+}
+
+// NewOriginAllowList creates new instance of OriginAllowList with the given patterns.
+func NewOriginAllowList(patterns ...string) *OriginAllowList {
+	l := &OriginAllowList{}
+	l.Set(patterns...)
+
+	return l
+}
+
+// Set replaces the allowed patterns.
+func (l *OriginAllowList) Set(patterns ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := slices.Clone(patterns)
+	l.patterns.Store(&list)
+}
+
+// Add adds patterns to the list, patterns that are already in the list are skipped.
+func (l *OriginAllowList) Add(patterns ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := slices.Clone(*l.patterns.Load())
+
+	for _, pattern := range patterns {
+		if !slices.Contains(list, pattern) {
+			list = append(list, pattern)
+		}
+	}
+
+	l.patterns.Store(&list)
+}
+
+// Remove removes patterns from the list.
+func (l *OriginAllowList) Remove(patterns ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := slices.DeleteFunc(slices.Clone(*l.patterns.Load()), func(pattern string) bool {
+		return slices.Contains(patterns, pattern)
+	})
+
+	l.patterns.Store(&list)
+}
+
+// Patterns returns copy of the allowed patterns.
+func (l *OriginAllowList) Patterns() []string {
+	return slices.Clone(*l.patterns.Load())
+}
+
+// Check reports whether the origin is allowed by the current patterns, it can be used as OriginChecker.
+func (l *OriginAllowList) Check(r *http.Request, origin string) bool {
+	return matchOrigin(r, origin, *l.patterns.Load())
+}
+
+// matchOrigin reports whether the origin has the same host as the request or matches any of the patterns.
+func matchOrigin(r *http.Request, origin string, patterns []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(r.Host, u.Host) {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		target := u.Host
+		if strings.Contains(pattern, "://") {
+			target = u.Scheme + "://" + u.Host
+		}
+
+		if matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(target)); err == nil && matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkOrigin checks Origin header of the handshake request with the origin checker of the channel,
+// or with the origin patterns if the checker is not set.
+// Rejected requests are logged and responded with status 403 (forbidden).
+func (c *Channel) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	var allowed bool
+	if c.config.originChecker != nil {
+		allowed = c.config.originChecker(r, origin)
+	} else {
+		allowed = matchOrigin(r, origin, c.config.originPatterns)
+	}
+
+	if allowed {
+		return true
+	}
+
+	slog.Warn("Rejected websocket handshake from disallowed origin",
+		slog.String("origin", origin),
+		slog.String("host", r.Host),
+		slog.String("path", r.URL.Path),
+		slog.String("remote_addr", r.RemoteAddr),
+	)
+
+	http.Error(w, "Origin not allowed", http.StatusForbidden)
+
+	return false
+}
+
+// WithOriginChecker sets the function that validates Origin header of handshake requests,
+// it replaces the patterns set with WithOriginPatterns.
+// The checker has access to the full request, so allowed origins can depend on the host, path or headers.
+// To change allowed patterns at runtime, use OriginAllowList.Check as the checker.
+func WithOriginChecker(checker OriginChecker) Option {
+	return func(c *channelConfig) {
+		c.originChecker = checker
+	}
+}
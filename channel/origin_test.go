@@ -0,0 +1,114 @@
+package channel
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ksysoev/wasabi/mocks"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		origin   string
+		patterns []string
+		expected bool
+	}{
+		{name: "same host", origin: "https://example.com", expected: true},
+		{name: "host pattern", origin: "https://app.tenant.io", patterns: []string{"*.tenant.io"}, expected: true},
+		{name: "case insensitive", origin: "https://APP.Tenant.io", patterns: []string{"*.tenant.io"}, expected: true},
+		{name: "scheme pattern", origin: "https://app.tenant.io", patterns: []string{"https://*.tenant.io"}, expected: true},
+		{name: "scheme mismatch", origin: "http://app.tenant.io", patterns: []string{"https://*.tenant.io"}, expected: false},
+		{name: "no match", origin: "https://evil.com", patterns: []string{"*.tenant.io"}, expected: false},
+		{name: "bad pattern", origin: "https://evil.com", patterns: []string{"["}, expected: false},
+		{name: "invalid origin", origin: "://", patterns: []string{"*"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+
+			if got := matchOrigin(req, tt.origin, tt.patterns); got != tt.expected {
+				t.Errorf("Unexpected result: got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOriginAllowList(t *testing.T) {
+	list := NewOriginAllowList("a.com")
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+
+	if !list.Check(req, "https://a.com") {
+		t.Error("Expected origin to be allowed")
+	}
+
+	list.Add("b.com", "a.com")
+
+	if !slices.Equal(list.Patterns(), []string{"a.com", "b.com"}) {
+		t.Errorf("Unexpected patterns: %v", list.Patterns())
+	}
+
+	list.Remove("a.com")
+
+	if list.Check(req, "https://a.com") {
+		t.Error("Expected removed origin to be rejected")
+	}
+
+	list.Set("*.c.com")
+
+	if list.Check(req, "https://b.com") || !list.Check(req, "https://www.c.com") {
+		t.Errorf("Expected patterns to be replaced, but got %v", list.Patterns())
+	}
+}
+
+func TestChannel_CheckOrigin(t *testing.T) {
+	allowList := NewOriginAllowList("*.tenant.io")
+
+	tests := []struct {
+		name         string
+		origin       string
+		opts         []Option
+		expectedCode int
+	}{
+		{name: "no origin", expectedCode: http.StatusUpgradeRequired},
+		{name: "default patterns", origin: "https://evil.com", expectedCode: http.StatusUpgradeRequired},
+		{name: "static patterns", origin: "https://evil.com", opts: []Option{WithOriginPatterns("*.tenant.io")}, expectedCode: http.StatusForbidden},
+		{name: "allow list", origin: "https://app.tenant.io", opts: []Option{WithOriginChecker(allowList.Check)}, expectedCode: http.StatusUpgradeRequired},
+		{name: "allow list rejects", origin: "https://evil.com", opts: []Option{WithOriginChecker(allowList.Check)}, expectedCode: http.StatusForbidden},
+		{
+			name:   "checker replaces patterns",
+			origin: "https://evil.com",
+			opts: []Option{
+				WithOriginPatterns("*"),
+				WithOriginChecker(func(_ *http.Request, _ string) bool { return false }),
+			},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connRegistry := mocks.NewMockConnectionRegistry(t)
+			connRegistry.EXPECT().CanAccept().Return(true)
+
+			channel := NewChannel("/", mocks.NewMockDispatcher(t), connRegistry, tt.opts...)
+
+			// The request is not a valid websocket handshake, so accepted origins fail the upgrade with 426
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", http.NoBody)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			w := httptest.NewRecorder()
+
+			channel.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Unexpected status code: got %d, expected %d", w.Code, tt.expectedCode)
+			}
+		})
+	}
+}
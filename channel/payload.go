@@ -0,0 +1,145 @@
+package channel
+
+import (
+	"bytes"
+	"log/slog"
+	"sync"
+	"unsafe"
+)
+
+// poisonByte is written over payloads returned to the pool in the poisoning debug mode.
+const poisonByte = 0xDE
+
+// lentPayload is a buffer with the message payload that is lent to handlers.
+type lentPayload struct {
+	buffer *bytes.Buffer
+	refs   int
+}
+
+// payloadKey returns the key of the payload in the map of lent payloads, it's the address of the first byte of the payload.
+func payloadKey(data []byte) *byte {
+	if cap(data) == 0 {
+		return nil
+	}
+
+	return &data[:1][0]
+}
+
+// lendPayload registers the buffer as lent to the OnMessage callback.
+func (c *Conn) lendPayload(buffer *bytes.Buffer) *byte {
+	key := payloadKey(buffer.Bytes())
+	if key == nil {
+		return nil
+	}
+
+	c.payloadsMu.Lock()
+	c.payloads[key] = &lentPayload{buffer: buffer, refs: 1}
+	c.payloadsMu.Unlock()
+
+	return key
+}
+
+// contains reports whether the data points into the buffer of the payload.
+func (p *lentPayload) contains(data []byte) bool {
+	buf := p.buffer.Bytes()
+	if cap(buf) == 0 || cap(data) == 0 {
+		return false
+	}
+
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(buf)))
+	addr := uintptr(unsafe.Pointer(unsafe.SliceData(data)))
+
+	return addr >= start && addr < start+uintptr(cap(buf))
+}
+
+// findPayload returns the key of the lent payload the data belongs to, the data can be a sub-slice of the payload.
+// It must be called with payloadsMu held.
+func (c *Conn) findPayload(data []byte) (*byte, *lentPayload) {
+	key := payloadKey(data)
+	if payload, ok := c.payloads[key]; ok {
+		return key, payload
+	}
+
+	for key, payload := range c.payloads {
+		if payload.contains(data) {
+			return key, payload
+		}
+	}
+
+	return nil, nil
+}
+
+// RetainPayload keeps the payload of the incoming message valid until the returned release function is called.
+// The data can be the payload or any sub-slice of it, e.g. a field of the parsed message.
+// The buffer of the payload is returned to the pool only after the callback returns and all retains are released.
+// Calling release more than once is a no-op.
+// If the data is not a payload lent by this connection, release does nothing,
+// in the poisoning debug mode such calls are logged.
+func (c *Conn) RetainPayload(data []byte) (release func()) {
+	c.payloadsMu.Lock()
+	key, payload := c.findPayload(data)
+
+	if payload != nil {
+		payload.refs++
+	}
+	c.payloadsMu.Unlock()
+
+	if payload == nil {
+		if c.poisonPayloads && cap(data) > 0 {
+			slog.Warn("Retained data is not a payload lent by the connection", slog.String("conn_id", c.id))
+		}
+
+		return func() {}
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			c.releasePayload(key, payload.buffer)
+		})
+	}
+}
+
+// releasePayload drops one reference to the lent payload and recycles its buffer when there are no references left.
+func (c *Conn) releasePayload(key *byte, buffer *bytes.Buffer) {
+	if key == nil {
+		c.recycle(buffer)
+		return
+	}
+
+	c.payloadsMu.Lock()
+	payload := c.payloads[key]
+	payload.refs--
+
+	if payload.refs > 0 {
+		c.payloadsMu.Unlock()
+		return
+	}
+
+	delete(c.payloads, key)
+	c.payloadsMu.Unlock()
+
+	c.recycle(buffer)
+}
+
+// recycle returns the buffer to the pool, in the poisoning debug mode the payload is overwritten first,
+// so handlers that keep using it without retaining read garbage, and the race detector reports the access.
+func (c *Conn) recycle(buffer *bytes.Buffer) {
+	if c.poisonPayloads {
+		data := buffer.Bytes()
+
+		for i := range data {
+			data[i] = poisonByte
+		}
+	}
+
+	c.bufferPool.Put(buffer)
+}
+
+// withPayloadPoisoning enables overwriting payloads when their buffers are returned to the pool.
+func withPayloadPoisoning() connOption {
+	return func(c *Conn) {
+		c.poisonPayloads = true
+	}
+}
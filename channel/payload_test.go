@@ -0,0 +1,187 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+// countingPool is a BufferPool that records returned buffers.
+type countingPool struct {
+	returned []*bytes.Buffer
+	mu       sync.Mutex
+}
+
+func (p *countingPool) Get(int) *bytes.Buffer {
+	return &bytes.Buffer{}
+}
+
+func (p *countingPool) Put(b *bytes.Buffer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.returned = append(p.returned, b)
+}
+
+func (p *countingPool) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.returned)
+}
+
+// dispatchMessage passes the message to the connection callback the same way handleRequests does.
+func dispatchMessage(conn *Conn, msg string) *bytes.Buffer {
+	buffer := conn.bufferPool.Get(0)
+	buffer.WriteString(msg)
+
+	conn.sem <- struct{}{}
+	conn.reqWG.Add(1)
+	conn.dispatch(wasabi.MsgTypeText, buffer)
+	conn.reqWG.Wait()
+
+	return buffer
+}
+
+func TestConn_RetainPayload(t *testing.T) {
+	pool := &countingPool{}
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, pool, 1, 0)
+
+	var (
+		retained []byte
+		release  func()
+	)
+
+	conn.onMessageCB = func(c wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		retained = data
+		release = wasabi.RetainPayload(c, data)
+	}
+
+	dispatchMessage(conn, "test message")
+
+	if pool.count() != 0 {
+		t.Fatal("Expected retained payload not to be returned to the pool")
+	}
+
+	if string(retained) != "test message" {
+		t.Errorf("Expected retained payload %q, but got %q", "test message", string(retained))
+	}
+
+	release()
+
+	if pool.count() != 1 {
+		t.Fatalf("Expected payload to be returned to the pool after release, but got %d buffers", pool.count())
+	}
+
+	release()
+
+	if pool.count() != 1 {
+		t.Errorf("Expected second release to be no-op, but got %d buffers", pool.count())
+	}
+
+	if len(conn.payloads) != 0 {
+		t.Errorf("Expected no lent payloads, but got %d", len(conn.payloads))
+	}
+}
+
+func TestConn_RetainPayload_SubSlice(t *testing.T) {
+	pool := &countingPool{}
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, pool, 1, 0)
+
+	var (
+		retained []byte
+		release  func()
+	)
+
+	conn.onMessageCB = func(c wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		retained = data[5:]
+		release = wasabi.RetainPayload(c, retained)
+	}
+
+	dispatchMessage(conn, "test message")
+
+	if pool.count() != 0 {
+		t.Fatal("Expected payload retained by its sub-slice not to be returned to the pool")
+	}
+
+	if string(retained) != "message" {
+		t.Errorf("Expected retained payload %q, but got %q", "message", string(retained))
+	}
+
+	release()
+
+	if pool.count() != 1 {
+		t.Errorf("Expected payload to be returned to the pool after release, but got %d buffers", pool.count())
+	}
+}
+
+func TestConn_RetainPayload_NotRetained(t *testing.T) {
+	pool := &countingPool{}
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, pool, 1, 0)
+
+	conn.onMessageCB = func(wasabi.Connection, wasabi.MessageType, []byte) {}
+
+	dispatchMessage(conn, "test message")
+
+	if pool.count() != 1 {
+		t.Errorf("Expected payload to be returned to the pool after the callback, but got %d buffers", pool.count())
+	}
+
+	// Data that is not lent by the connection can't be retained
+	release := conn.RetainPayload([]byte("other data"))
+	release()
+
+	if pool.count() != 1 {
+		t.Errorf("Expected release of unknown payload to be no-op, but got %d buffers", pool.count())
+	}
+}
+
+func TestConn_RetainPayload_Async(t *testing.T) {
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0, withPayloadPoisoning())
+
+	received := make(chan string, 1)
+
+	conn.onMessageCB = func(c wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		release := wasabi.RetainPayload(c, data)
+
+		go func() {
+			defer release()
+
+			time.Sleep(10 * time.Millisecond)
+			received <- string(data)
+		}()
+	}
+
+	dispatchMessage(conn, "test message")
+
+	select {
+	case msg := <-received:
+		if msg != "test message" {
+			t.Errorf("Expected retained payload %q, but got %q", "test message", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected payload to be processed asynchronously")
+	}
+}
+
+func TestConn_PayloadPoisoning(t *testing.T) {
+	pool := &countingPool{}
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, pool, 1, 0, withPayloadPoisoning())
+
+	var leaked []byte
+
+	conn.onMessageCB = func(_ wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		leaked = data
+	}
+
+	dispatchMessage(conn, "test")
+
+	if !bytes.Equal(leaked, []byte{poisonByte, poisonByte, poisonByte, poisonByte}) {
+		t.Errorf("Expected leaked payload to be poisoned, but got %q", leaked)
+	}
+}
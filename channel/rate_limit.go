@@ -0,0 +1,155 @@
+package channel
+
+import (
+	"context"
+	"time"
+)
+
+// LimitAction defines what happens when a connection exceeds its inbound rate limits.
+type LimitAction int
+
+const (
+	// LimitActionDelay delays reading and dispatching of messages until the connection is within its limits again,
+	// so flooding clients are slowed down by the TCP backpressure.
+	LimitActionDelay LimitAction = iota
+	// LimitActionClose closes the connection with websocket.StatusPolicyViolation.
+	LimitActionClose
+)
+
+// rateLimit defines a token bucket limit: rate of units per second and the burst size.
+// Burst is the number of units that can be consumed at once after the connection was idle.
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// tokenBucket is a token bucket that allows tokens to go negative,
+// so a consumption larger than the burst is delayed instead of being rejected forever.
+type tokenBucket struct {
+	last   time.Time
+	rate   float64
+	burst  float64
+	tokens float64
+}
+
+// newTokenBucket creates new instance of tokenBucket, it's full initially.
+func newTokenBucket(limit rateLimit, now time.Time) *tokenBucket {
+	burst := float64(max(limit.burst, 1))
+
+	return &tokenBucket{
+		last:   now,
+		rate:   limit.rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// refill adds tokens accumulated since the last call.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+	}
+
+	b.last = now
+}
+
+// allows reports whether n tokens are available without consuming them.
+// A consumption larger than the burst is allowed when the bucket is full, otherwise it could never be allowed.
+func (b *tokenBucket) allows(n float64) bool {
+	return b.tokens >= n || b.tokens >= b.burst
+}
+
+// take consumes n tokens and returns how long the caller must wait until the bucket is not in debt.
+func (b *tokenBucket) take(n float64) time.Duration {
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// inboundLimiter enforces message rate and bandwidth limits of incoming messages of a single connection.
+// It's used only by the goroutine that reads the connection, so it's not safe for concurrent use.
+type inboundLimiter struct {
+	messages *tokenBucket
+	bytes    *tokenBucket
+	now      func() time.Time
+	action   LimitAction
+}
+
+// newInboundLimiter creates new instance of inboundLimiter, limits with zero rate are disabled.
+func newInboundLimiter(messages, bytes rateLimit, action LimitAction) *inboundLimiter {
+	l := &inboundLimiter{
+		now:    time.Now,
+		action: action,
+	}
+
+	now := l.now()
+
+	if messages.rate > 0 {
+		l.messages = newTokenBucket(messages, now)
+	}
+
+	if bytes.rate > 0 {
+		l.bytes = newTokenBucket(bytes, now)
+	}
+
+	return l
+}
+
+// reserve charges the given number of messages and bytes.
+// It returns the delay before the message can be dispatched,
+// or false if the limit is exceeded and the action is LimitActionClose.
+func (l *inboundLimiter) reserve(messages, bytes int) (time.Duration, bool) {
+	now := l.now()
+
+	type charge struct {
+		bucket *tokenBucket
+		n      float64
+	}
+
+	charges := [2]charge{{l.messages, float64(messages)}, {l.bytes, float64(bytes)}}
+
+	for _, c := range charges {
+		if c.bucket == nil || c.n == 0 {
+			continue
+		}
+
+		c.bucket.refill(now)
+
+		if l.action == LimitActionClose && !c.bucket.allows(c.n) {
+			return 0, false
+		}
+	}
+
+	var delay time.Duration
+
+	for _, c := range charges {
+		if c.bucket == nil || c.n == 0 {
+			continue
+		}
+
+		delay = max(delay, c.bucket.take(c.n))
+	}
+
+	return delay, true
+}
+
+// waitDelay blocks for the delay, it returns false if the context is done before that.
+func waitDelay(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,105 @@
+package channel
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInboundLimiter_Delay(t *testing.T) {
+	now := time.Now()
+
+	limiter := newInboundLimiter(rateLimit{rate: 10, burst: 2}, rateLimit{}, LimitActionDelay)
+	limiter.now = func() time.Time { return now }
+	limiter.messages.last = now
+
+	for i := 0; i < 2; i++ {
+		if delay, ok := limiter.reserve(1, 100); !ok || delay != 0 {
+			t.Fatalf("Expected message %d within the burst to pass, but got delay %v, ok %v", i, delay, ok)
+		}
+	}
+
+	if delay, ok := limiter.reserve(1, 100); !ok || delay != 100*time.Millisecond {
+		t.Errorf("Expected delay %v, but got %v, ok %v", 100*time.Millisecond, delay, ok)
+	}
+
+	if delay, _ := limiter.reserve(1, 100); delay != 200*time.Millisecond {
+		t.Errorf("Expected delay %v, but got %v", 200*time.Millisecond, delay)
+	}
+
+	now = now.Add(time.Second)
+
+	if delay, _ := limiter.reserve(1, 100); delay != 0 {
+		t.Errorf("Expected no delay after the bucket is refilled, but got %v", delay)
+	}
+}
+
+func TestInboundLimiter_Bandwidth(t *testing.T) {
+	now := time.Now()
+
+	limiter := newInboundLimiter(rateLimit{}, rateLimit{rate: 1000, burst: 500}, LimitActionDelay)
+	limiter.now = func() time.Time { return now }
+	limiter.bytes.last = now
+
+	// A message larger than the burst is allowed, but the next messages are delayed
+	if delay, ok := limiter.reserve(1, 1500); !ok || delay != time.Second {
+		t.Errorf("Expected delay %v, but got %v, ok %v", time.Second, delay, ok)
+	}
+
+	// Messages themselves are not limited
+	if delay, _ := limiter.reserve(100, 0); delay != 0 {
+		t.Errorf("Expected no delay, but got %v", delay)
+	}
+}
+
+func TestInboundLimiter_Close(t *testing.T) {
+	now := time.Now()
+
+	limiter := newInboundLimiter(rateLimit{rate: 1, burst: 1}, rateLimit{rate: 100, burst: 100}, LimitActionClose)
+	limiter.now = func() time.Time { return now }
+	limiter.messages.last = now
+	limiter.bytes.last = now
+
+	if _, ok := limiter.reserve(1, 10); !ok {
+		t.Fatal("Expected first message to pass")
+	}
+
+	if _, ok := limiter.reserve(1, 10); ok {
+		t.Error("Expected second message to exceed message rate")
+	}
+
+	now = now.Add(time.Second)
+
+	// A message larger than the burst passes when the bucket is full, and puts it into debt
+	if _, ok := limiter.reserve(1, 101); !ok {
+		t.Fatal("Expected large message to pass with the full bucket")
+	}
+
+	now = now.Add(time.Second)
+
+	if _, ok := limiter.reserve(1, 100); ok {
+		t.Error("Expected message to exceed bandwidth while the bucket is not refilled")
+	}
+
+	// Rejected messages are not charged
+	if _, ok := limiter.reserve(1, 90); !ok {
+		t.Error("Expected message within the limits to pass")
+	}
+}
+
+func TestWaitDelay(t *testing.T) {
+	if !waitDelay(context.Background(), 0) {
+		t.Error("Expected zero delay to pass")
+	}
+
+	if !waitDelay(context.Background(), time.Millisecond) {
+		t.Error("Expected delay to pass")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if waitDelay(ctx, time.Minute) {
+		t.Error("Expected wait to be interrupted by the context")
+	}
+}
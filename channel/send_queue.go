@@ -0,0 +1,141 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// OverflowPolicy defines what happens when a message is sent to a connection with a full send queue.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock blocks the sender until there is free space in the queue or the timeout expires.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest message in the queue to make room for the new one.
+	OverflowDropOldest
+	// OverflowDropNewest drops the message that is being sent.
+	OverflowDropNewest
+	// OverflowClose closes the connection with status 1008 (policy violation).
+	OverflowClose
+)
+
+var (
+	// ErrSendTimeout is error for messages that could not be queued before the send timeout expired
+	ErrSendTimeout = errors.New("send queue timeout")
+	// ErrMessageDropped is error for messages that were dropped because the send queue is full
+	ErrMessageDropped = errors.New("message dropped, send queue is full")
+
+	errSendQueueFull = errors.New("send queue is full")
+)
+
+// outMessage is a message waiting in the send queue.
+// If flushed is not nil, the message is a marker that is used to wait until all preceding messages are written.
+type outMessage struct {
+	flushed chan struct{}
+	data    []byte
+	msgType wasabi.MessageType
+}
+
+// sendQueue is a bounded queue of outgoing messages for a single connection.
+type sendQueue struct {
+	messages chan outMessage
+	dropped  atomic.Uint64
+	timeout  time.Duration
+	policy   OverflowPolicy
+}
+
+// newSendQueue creates new instance of sendQueue
+func newSendQueue(size int, policy OverflowPolicy, timeout time.Duration) *sendQueue {
+	return &sendQueue{
+		messages: make(chan outMessage, size),
+		policy:   policy,
+		timeout:  timeout,
+	}
+}
+
+// push puts the message to the queue according to the overflow policy.
+// It returns errSendQueueFull if the queue is full and the policy requires closing the connection.
+func (q *sendQueue) push(ctx context.Context, msg outMessage) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+	}
+
+	switch q.policy {
+	case OverflowDropOldest:
+		for {
+			select {
+			case old := <-q.messages:
+				q.discard(old)
+			default:
+			}
+
+			select {
+			case q.messages <- msg:
+				return nil
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		q.discard(msg)
+		return ErrMessageDropped
+	case OverflowClose:
+		q.discard(msg)
+		return errSendQueueFull
+	default:
+		var timeout <-chan time.Time
+
+		if q.timeout > 0 {
+			timer := time.NewTimer(q.timeout)
+			defer timer.Stop()
+
+			timeout = timer.C
+		}
+
+		select {
+		case q.messages <- msg:
+			return nil
+		case <-timeout:
+			q.discard(msg)
+			return ErrSendTimeout
+		case <-ctx.Done():
+			return ErrConnectionClosed
+		}
+	}
+}
+
+// discard accounts dropped message, flush markers are released instead of being counted.
+func (q *sendQueue) discard(msg outMessage) {
+	if msg.flushed != nil {
+		close(msg.flushed)
+		return
+	}
+
+	q.dropped.Add(1)
+}
+
+// flush waits until all messages that are currently in the queue are processed by the writer.
+func (q *sendQueue) flush(ctx context.Context) {
+	flushed := make(chan struct{})
+
+	select {
+	case q.messages <- outMessage{flushed: flushed}:
+	case <-ctx.Done():
+		return
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+	}
+}
+
+// len returns number of messages waiting in the queue.
+func (q *sendQueue) len() int {
+	return len(q.messages)
+}
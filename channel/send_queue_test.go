@@ -0,0 +1,162 @@
+package channel
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+func TestSendQueue_push_DropOldest(t *testing.T) {
+	q := newSendQueue(2, OverflowDropOldest, 0)
+
+	for _, data := range []string{"msg1", "msg2", "msg3"} {
+		if err := q.push(context.Background(), outMessage{msgType: wasabi.MsgTypeText, data: []byte(data)}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if q.len() != 2 {
+		t.Errorf("Expected queue length to be 2, but got %d", q.len())
+	}
+
+	if q.dropped.Load() != 1 {
+		t.Errorf("Expected 1 dropped message, but got %d", q.dropped.Load())
+	}
+
+	if msg := <-q.messages; string(msg.data) != "msg2" {
+		t.Errorf("Expected oldest message to be dropped, but got %s at the head", msg.data)
+	}
+}
+
+func TestSendQueue_push_DropNewest(t *testing.T) {
+	q := newSendQueue(1, OverflowDropNewest, 0)
+
+	if err := q.push(context.Background(), outMessage{data: []byte("msg1")}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := q.push(context.Background(), outMessage{data: []byte("msg2")}); err != ErrMessageDropped {
+		t.Errorf("Expected error %v, but got %v", ErrMessageDropped, err)
+	}
+
+	if q.dropped.Load() != 1 {
+		t.Errorf("Expected 1 dropped message, but got %d", q.dropped.Load())
+	}
+
+	if msg := <-q.messages; string(msg.data) != "msg1" {
+		t.Errorf("Expected newest message to be dropped, but got %s at the head", msg.data)
+	}
+}
+
+func TestSendQueue_push_Close(t *testing.T) {
+	q := newSendQueue(1, OverflowClose, 0)
+
+	_ = q.push(context.Background(), outMessage{data: []byte("msg1")})
+
+	if err := q.push(context.Background(), outMessage{data: []byte("msg2")}); err != errSendQueueFull {
+		t.Errorf("Expected error %v, but got %v", errSendQueueFull, err)
+	}
+}
+
+func TestSendQueue_push_BlockTimeout(t *testing.T) {
+	q := newSendQueue(1, OverflowBlock, 10*time.Millisecond)
+
+	_ = q.push(context.Background(), outMessage{data: []byte("msg1")})
+
+	if err := q.push(context.Background(), outMessage{data: []byte("msg2")}); err != ErrSendTimeout {
+		t.Errorf("Expected error %v, but got %v", ErrSendTimeout, err)
+	}
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		<-q.messages
+	}()
+
+	if err := q.push(context.Background(), outMessage{data: []byte("msg3")}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSendQueue_push_BlockCanceled(t *testing.T) {
+	q := newSendQueue(1, OverflowBlock, 0)
+
+	_ = q.push(context.Background(), outMessage{data: []byte("msg1")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := q.push(ctx, outMessage{data: []byte("msg2")}); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestConn_Send_WithSendQueue(t *testing.T) {
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	url := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Errorf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	received := make(chan string, 3)
+	conn := NewConnection(context.Background(), ws, func(_ wasabi.Connection, _ wasabi.MessageType, data []byte) {
+		received <- string(data)
+	}, NewSizeClassBufferPool(), 1, 0, withSendQueue(10, OverflowBlock, 0))
+
+	go conn.handleRequests()
+
+	defer conn.close()
+
+	msg := []byte("msg1")
+
+	if err := conn.Send(wasabi.MsgTypeText, msg); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// The message is copied to the queue, so the caller can reuse the buffer.
+	copy(msg, "xxxx")
+
+	select {
+	case data := <-received:
+		if data != "msg1" {
+			t.Errorf("Expected to receive msg1, but got %s", data)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected queued message to be delivered")
+	}
+
+	if conn.QueueLen() != 0 {
+		t.Errorf("Expected queue to be empty, but got %d", conn.QueueLen())
+	}
+
+	if conn.DroppedMessages() != 0 {
+		t.Errorf("Expected no dropped messages, but got %d", conn.DroppedMessages())
+	}
+}
+
+func TestConn_Send_QueueOverflowClose(t *testing.T) {
+	conn := NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0)
+	conn.sendQueue = newSendQueue(1, OverflowClose, 0)
+	conn.state.Store(int32(terminated))
+
+	if err := conn.Send(wasabi.MsgTypeText, []byte("msg1")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := conn.Send(wasabi.MsgTypeText, []byte("msg2")); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+}
@@ -0,0 +1,385 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+
+	"github.com/ksysoev/wasabi"
+)
+
+const (
+	// AttrResumeToken is the connection attribute with the token that can be used to resume the session.
+	AttrResumeToken = "wasabi.resume_token"
+	// AttrSessionResumed is the connection attribute that is true if the connection resumed an existing session.
+	AttrSessionResumed = "wasabi.session_resumed"
+	// AttrSessionSuspended is the connection attribute that is true if the session of the disconnected connection
+	// is kept for the grace period and can be resumed.
+	AttrSessionSuspended = "wasabi.session_suspended"
+
+	// ResumeTokenParam is the query parameter of the handshake request with the resume token.
+	ResumeTokenParam = "resume_token"
+	// LastSeqParam is the query parameter of the handshake request with the sequence number
+	// of the last message received by the client.
+	LastSeqParam = "last_seq"
+)
+
+type resumeRequestKey struct{}
+
+// resumeRequest holds session resumption parameters of the handshake request.
+type resumeRequest struct {
+	token   string
+	lastSeq uint64
+}
+
+// withResumeRequest returns a copy of the context with session resumption parameters from the handshake request.
+// If the request has no resume token, the context is returned unchanged.
+func withResumeRequest(ctx context.Context, r *http.Request) context.Context {
+	query := r.URL.Query()
+
+	token := query.Get(ResumeTokenParam)
+	if token == "" {
+		return ctx
+	}
+
+	lastSeq, err := strconv.ParseUint(query.Get(LastSeqParam), 10, 64)
+	if err != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, resumeRequestKey{}, resumeRequest{token: token, lastSeq: lastSeq})
+}
+
+// resumeRequestFromContext returns session resumption parameters stored in the context.
+func resumeRequestFromContext(ctx context.Context) (resumeRequest, bool) {
+	req, ok := ctx.Value(resumeRequestKey{}).(resumeRequest)
+	return req, ok
+}
+
+// sessionMessage is an outgoing message kept in the replay buffer.
+type sessionMessage struct {
+	data    []byte
+	seq     uint64
+	msgType wasabi.MessageType
+}
+
+// session is a logical session that can outlive a single connection.
+// Every message sent to the session gets a sequence number and is kept in the bounded replay buffer,
+// so the client that reconnects with the resume token can receive the messages it missed.
+// The session lock only guards the state of the session, messages are written to the connection outside of it,
+// in order of their sequence numbers under the separate delivery lock.
+type session struct {
+	conn      *Conn
+	last      *Conn
+	expiry    *time.Timer
+	token     string
+	connID    string
+	buffer    []sessionMessage
+	pending   []sessionMessage
+	size      int
+	seq       uint64
+	mu        sync.Mutex
+	deliverMu sync.Mutex
+	expired   bool
+	resuming  bool
+}
+
+// send records the message in the replay buffer and delivers it to the currently attached connection.
+// If the session is suspended, the message is only buffered and will be replayed when the session is resumed.
+func (s *session) send(msgType wasabi.MessageType, msg []byte) error {
+	data := make([]byte, len(msg))
+	copy(data, msg)
+
+	s.mu.Lock()
+
+	if s.expired {
+		s.mu.Unlock()
+		return ErrConnectionClosed
+	}
+
+	s.seq++
+	m := sessionMessage{seq: s.seq, msgType: msgType, data: data}
+	s.buffer = append(s.buffer, m)
+
+	if len(s.buffer) > s.size {
+		s.buffer[0] = sessionMessage{}
+		s.buffer = s.buffer[1:]
+	}
+
+	if s.conn != nil {
+		s.pending = append(s.pending, m)
+	}
+
+	s.mu.Unlock()
+
+	return s.flush()
+}
+
+// flush delivers messages that are waiting for delivery to the attached connection.
+// Concurrent sends are delivered by whichever of them gets the delivery lock first, in order of their sequence numbers.
+func (s *session) flush() error {
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	s.mu.Lock()
+	conn, pending := s.conn, s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	for _, m := range pending {
+		err := conn.deliver(m.msgType, m.data)
+		if errors.Is(err, ErrConnectionClosed) {
+			// The connection is going away, the messages stay in the buffer and can be replayed after resumption.
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attach attaches the new connection to the session and replays messages with sequence number greater than lastSeq.
+// It returns false if the messages after lastSeq are not available in the replay buffer anymore.
+func (s *session) attach(conn *Conn, lastSeq uint64) bool {
+	// Messages sent while the buffer is replayed wait for the delivery lock, so they are delivered after the replay.
+	s.deliverMu.Lock()
+	defer s.deliverMu.Unlock()
+
+	s.mu.Lock()
+
+	if s.expired || lastSeq > s.seq {
+		s.mu.Unlock()
+		return false
+	}
+
+	firstSeq := s.seq + 1
+	if len(s.buffer) > 0 {
+		firstSeq = s.buffer[0].seq
+	}
+
+	if lastSeq+1 < firstSeq {
+		s.mu.Unlock()
+		return false
+	}
+
+	if s.last != nil {
+		s.last.attrs.Range(func(key, value any) bool {
+			_, _ = conn.attrs.LoadOrStore(key, value)
+			return true
+		})
+	}
+
+	replay := make([]sessionMessage, 0, len(s.buffer))
+
+	for _, m := range s.buffer {
+		if m.seq > lastSeq {
+			replay = append(replay, m)
+		}
+	}
+
+	s.conn = conn
+	s.pending = nil
+	s.mu.Unlock()
+
+	for _, m := range replay {
+		if err := conn.deliver(m.msgType, m.data); err != nil {
+			s.mu.Lock()
+			s.conn = nil
+			s.pending = nil
+			s.mu.Unlock()
+
+			return false
+		}
+	}
+
+	s.mu.Lock()
+	s.last = conn
+	s.resuming = false
+	s.mu.Unlock()
+
+	return true
+}
+
+// resumableClose reports whether the session of the connection closed with the close info can be resumed.
+// Only connections that were lost can be resumed: closed by the client, or terminated without the closing handshake,
+// e.g. after missed heartbeats. Connections closed deliberately by the server can't be resumed.
+func resumableClose(info *wasabi.CloseInfo) bool {
+	return info == nil || info.Initiator == wasabi.ClosedByClient || info.Code == websocket.StatusAbnormalClosure
+}
+
+// sessionStore keeps sessions of active connections and suspended sessions waiting for resumption.
+type sessionStore struct {
+	byToken     map[string]*session
+	byConnID    map[string]*session
+	onExpire    func(s *session)
+	gracePeriod time.Duration
+	bufferSize  int
+	mu          sync.Mutex
+}
+
+// newSessionStore creates new instance of sessionStore
+func newSessionStore(gracePeriod time.Duration, bufferSize int, onExpire func(s *session)) *sessionStore {
+	return &sessionStore{
+		byToken:     make(map[string]*session),
+		byConnID:    make(map[string]*session),
+		onExpire:    onExpire,
+		gracePeriod: gracePeriod,
+		bufferSize:  bufferSize,
+	}
+}
+
+// create creates new session for the connection.
+func (st *sessionStore) create(conn *Conn) *session {
+	s := &session{
+		token:  uuid.New().String(),
+		connID: conn.ID(),
+		conn:   conn,
+		last:   conn,
+		size:   st.bufferSize,
+		buffer: make([]sessionMessage, 0, st.bufferSize),
+	}
+
+	st.mu.Lock()
+	st.byToken[s.token] = s
+	st.byConnID[s.connID] = s
+	st.mu.Unlock()
+
+	return s
+}
+
+// take returns the suspended session with the given token and stops its expiration timer.
+// The session is marked as resuming, so it can't be taken twice.
+func (st *sessionStore) take(token string) *session {
+	st.mu.Lock()
+	s, ok := st.byToken[token]
+	st.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	// The session is locked after the store is released, so a session that is busy doesn't block other sessions.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expired || s.conn != nil || s.resuming {
+		return nil
+	}
+
+	if s.expiry != nil && !s.expiry.Stop() {
+		// The timer has already fired, the session is being expired.
+		return nil
+	}
+
+	s.resuming = true
+
+	return s
+}
+
+// suspend detaches the connection from the session and keeps the session for the grace period.
+func (st *sessionStore) suspend(s *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expired {
+		return
+	}
+
+	s.conn = nil
+	s.pending = nil
+	s.expiry = time.AfterFunc(st.gracePeriod, func() {
+		st.expire(s)
+	})
+}
+
+// expire removes the session from the store, after that messages sent to the session are rejected.
+func (st *sessionStore) expire(s *session) {
+	st.mu.Lock()
+	if st.byToken[s.token] == s {
+		delete(st.byToken, s.token)
+		delete(st.byConnID, s.connID)
+	}
+	st.mu.Unlock()
+
+	s.mu.Lock()
+	alreadyExpired := s.expired
+	s.expired = true
+	s.conn = nil
+	s.pending = nil
+
+	if s.expiry != nil {
+		s.expiry.Stop()
+	}
+	s.mu.Unlock()
+
+	if !alreadyExpired && st.onExpire != nil {
+		st.onExpire(s)
+	}
+}
+
+// suspended returns the last connection of the suspended session for the connection id.
+func (st *sessionStore) suspended(id string) *Conn {
+	st.mu.Lock()
+	s, ok := st.byConnID[id]
+	st.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.expired || s.conn != nil {
+		return nil
+	}
+
+	return s.last
+}
+
+// expireByID expires the session of the connection with the given id.
+func (st *sessionStore) expireByID(id string) {
+	st.mu.Lock()
+	s, ok := st.byConnID[id]
+	st.mu.Unlock()
+
+	if ok {
+		st.expire(s)
+	}
+}
+
+// expireAll expires all sessions in the store.
+func (st *sessionStore) expireAll() {
+	st.mu.Lock()
+	sessions := make([]*session, 0, len(st.byToken))
+
+	for _, s := range st.byToken {
+		sessions = append(sessions, s)
+	}
+	st.mu.Unlock()
+
+	for _, s := range sessions {
+		st.expire(s)
+	}
+}
+
+// count returns number of sessions in the store.
+func (st *sessionStore) count() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return len(st.byToken)
+}
@@ -0,0 +1,398 @@
+package channel
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSession_send_Suspended(t *testing.T) {
+	st := newSessionStore(time.Minute, 2, nil)
+	s := st.create(NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0))
+
+	st.suspend(s)
+	defer st.expire(s)
+
+	for _, msg := range []string{"msg1", "msg2", "msg3"} {
+		if err := s.send(wasabi.MsgTypeText, []byte(msg)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	if len(s.buffer) != 2 {
+		t.Fatalf("Expected replay buffer to keep 2 messages, but got %d", len(s.buffer))
+	}
+
+	if s.buffer[0].seq != 2 || string(s.buffer[0].data) != "msg2" {
+		t.Errorf("Expected oldest message to be evicted, but got seq %d", s.buffer[0].seq)
+	}
+
+	// msg1 is not in the buffer anymore, so the session can't be resumed from the beginning.
+	if s.attach(NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0), 0) {
+		t.Error("Expected session not to be resumed when missed messages are evicted")
+	}
+
+	// The client can't have seen more messages than were sent.
+	if s.attach(NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0), 4) {
+		t.Error("Expected session not to be resumed with sequence number from the future")
+	}
+}
+
+func TestSession_send_Expired(t *testing.T) {
+	expired := make(chan string, 1)
+	st := newSessionStore(10*time.Millisecond, 10, func(s *session) { expired <- s.connID })
+	s := st.create(NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0))
+
+	st.suspend(s)
+
+	select {
+	case id := <-expired:
+		if id != s.connID {
+			t.Errorf("Expected session %s to be expired, but got %s", s.connID, id)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected session to expire after the grace period")
+	}
+
+	if err := s.send(wasabi.MsgTypeText, []byte("msg")); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+
+	if st.take(s.token) != nil {
+		t.Error("Expected expired session not to be resumable")
+	}
+
+	if st.count() != 0 {
+		t.Errorf("Expected session store to be empty, but got %d sessions", st.count())
+	}
+}
+
+func TestSession_send_StuckWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	st := newSessionStore(time.Minute, 10, nil)
+	s := st.create(NewConnection(ctx, &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0))
+
+	// Simulate the delivery stuck in a write to the half-open socket.
+	s.deliverMu.Lock()
+
+	sent := make(chan struct{})
+
+	go func() {
+		_ = s.send(wasabi.MsgTypeText, []byte("msg"))
+		close(sent)
+	}()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// The session store and the session state are not blocked by the write.
+		if st.take(s.token) != nil {
+			t.Error("Expected attached session not to be resumable")
+		}
+
+		other := st.create(NewConnection(context.Background(), &websocket.Conn{}, nil, NewSizeClassBufferPool(), 1, 0))
+		st.expire(other)
+
+		for {
+			s.mu.Lock()
+			buffered := len(s.buffer)
+			s.mu.Unlock()
+
+			if buffered == 1 {
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected session store operations not to wait for the write")
+	}
+
+	s.deliverMu.Unlock()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Expected message to be delivered after the write is unblocked")
+	}
+}
+
+func TestConnectionRegistry_SessionResumption(t *testing.T) {
+	var registry *ConnectionRegistry
+
+	connected := make(chan wasabi.Connection, 2)
+	disconnected := make(chan wasabi.Connection, 2)
+
+	registry = NewConnectionRegistry(
+		WithSessionResumption(time.Minute, 10),
+		WithOnConnectHook(func(conn wasabi.Connection) {
+			if resumed, _ := wasabi.GetAttr[bool](conn, AttrSessionResumed); !resumed {
+				token, _ := wasabi.GetAttr[string](conn, AttrResumeToken)
+				_ = conn.Send(wasabi.MsgTypeText, []byte(token))
+			}
+
+			connected <- conn
+		}),
+		WithOnDisconnectHook(func(conn wasabi.Connection, _ *wasabi.CloseInfo) { disconnected <- conn }),
+	)
+
+	dispatcher := mocks.NewMockDispatcher(t)
+	dispatcher.EXPECT().Dispatch(mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	server := httptest.NewServer(NewChannel("/", dispatcher, registry).Handler())
+	defer server.Close()
+
+	wsURL := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), wsURL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	conn := <-connected
+
+	if err := registry.AddIndexKey(conn.ID(), "user:1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := registry.Subscribe(conn.ID(), "news"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, token, err := ws.Read(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error reading resume token: %v", err)
+	}
+
+	_ = ws.CloseNow()
+
+	select {
+	case conn := <-disconnected:
+		if suspended, _ := wasabi.GetAttr[bool](conn, AttrSessionSuspended); !suspended {
+			t.Error("Expected session to be suspended on disconnect")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be disconnected")
+	}
+
+	// Messages sent while the client is away are buffered
+	suspendedConn := registry.GetConnection(conn.ID())
+	if suspendedConn == nil {
+		t.Fatal("Expected suspended connection to be available in the registry")
+	}
+
+	for _, msg := range []string{"msg2", "msg3"} {
+		if err := suspendedConn.Send(wasabi.MsgTypeText, []byte(msg)); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	query := url.Values{}
+	query.Set(ResumeTokenParam, string(token))
+	query.Set(LastSeqParam, strconv.Itoa(1))
+
+	ws, resp, err = websocket.Dial(context.Background(), wsURL+"/?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	resumedConn := <-connected
+
+	if resumedConn.ID() != conn.ID() {
+		t.Errorf("Expected resumed connection to keep id %s, but got %s", conn.ID(), resumedConn.ID())
+	}
+
+	if resumed, _ := wasabi.GetAttr[bool](resumedConn, AttrSessionResumed); !resumed {
+		t.Error("Expected connection to be resumed")
+	}
+
+	for _, expected := range []string{"msg2", "msg3"} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, data, err := ws.Read(ctx)
+
+		cancel()
+
+		if err != nil {
+			t.Fatalf("Unexpected error reading replayed message: %v", err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Expected replayed message %s, but got %s", expected, data)
+		}
+	}
+
+	// Messages sent to the original connection are delivered to the resumed one.
+	if err := conn.Send(wasabi.MsgTypeText, []byte("msg4")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, data, err := ws.Read(ctx); err != nil || string(data) != "msg4" {
+		t.Errorf("Expected to receive msg4, but got %s (%v)", data, err)
+	}
+
+	// Subscriptions and index keys are moved to the resumed connection.
+	if subscribers := registry.topics.get("news"); len(subscribers) != 1 || subscribers[0] != resumedConn {
+		t.Errorf("Expected topic to point to the resumed connection, but got %v", subscribers)
+	}
+
+	byKey := registry.GetConnectionsByKey("user:1")
+	if len(byKey) != 1 || byKey[0] != resumedConn {
+		t.Fatalf("Expected index key to point to the resumed connection, but got %v", byKey)
+	}
+
+	if err := byKey[0].Close(websocket.StatusNormalClosure, "bye", ctx); err != nil {
+		t.Errorf("Unexpected error closing resumed connection: %v", err)
+	}
+}
+
+func TestConnectionRegistry_SessionResumption_ServerClose(t *testing.T) {
+	connected := make(chan wasabi.Connection, 2)
+	disconnected := make(chan wasabi.Connection, 2)
+
+	registry := NewConnectionRegistry(
+		WithSessionResumption(time.Minute, 10),
+		WithOnConnectHook(func(conn wasabi.Connection) { connected <- conn }),
+		WithOnDisconnectHook(func(conn wasabi.Connection, _ *wasabi.CloseInfo) { disconnected <- conn }),
+	)
+	defer func() { _ = registry.Close() }()
+
+	dispatcher := mocks.NewMockDispatcher(t)
+	dispatcher.EXPECT().Dispatch(mock.Anything, mock.Anything, mock.Anything).Maybe()
+
+	server := httptest.NewServer(NewChannel("/", dispatcher, registry).Handler())
+	defer server.Close()
+
+	wsURL := "ws://" + server.Listener.Addr().String()
+
+	ws, resp, err := websocket.Dial(context.Background(), wsURL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	conn := <-connected
+	token, _ := wasabi.GetAttr[string](conn, AttrResumeToken)
+
+	go func() { _, _, _ = ws.Read(context.Background()) }()
+
+	if err := conn.Close(websocket.StatusPolicyViolation, "banned"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case conn := <-disconnected:
+		if suspended, _ := wasabi.GetAttr[bool](conn, AttrSessionSuspended); suspended {
+			t.Error("Expected session of the connection closed by the server not to be suspended")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected connection to be disconnected")
+	}
+
+	if registry.GetConnection(conn.ID()) != nil {
+		t.Error("Expected closed connection to be removed from the registry")
+	}
+
+	if registry.sessions.count() != 0 {
+		t.Errorf("Expected session to be expired, but got %d sessions", registry.sessions.count())
+	}
+
+	query := url.Values{}
+	query.Set(ResumeTokenParam, token)
+	query.Set(LastSeqParam, "0")
+
+	ws2, resp, err := websocket.Dial(context.Background(), wsURL+"/?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws2.CloseNow() }()
+
+	newConn := <-connected
+
+	if resumed, _ := wasabi.GetAttr[bool](newConn, AttrSessionResumed); resumed || newConn.ID() == conn.ID() {
+		t.Error("Expected connection closed by the server not to be resumed")
+	}
+}
+
+func TestConnectionRegistry_SessionResumption_UnknownToken(t *testing.T) {
+	registry := NewConnectionRegistry(WithSessionResumption(time.Minute, 10))
+
+	server := httptest.NewServer(wsHandlerEcho)
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), resumeRequestKey{}, resumeRequest{token: "unknown"}))
+	cancel()
+
+	connected := make(chan wasabi.Connection, 1)
+	registry.onConnect = func(conn wasabi.Connection) { connected <- conn }
+
+	registry.HandleConnection(ctx, ws, func(wasabi.Connection, wasabi.MessageType, []byte) {})
+
+	conn := <-connected
+
+	if resumed, _ := wasabi.GetAttr[bool](conn, AttrSessionResumed); resumed {
+		t.Error("Expected new session to be started for unknown token")
+	}
+
+	if token, _ := wasabi.GetAttr[string](conn, AttrResumeToken); token == "" || token == "unknown" {
+		t.Errorf("Expected new resume token to be issued, but got %q", token)
+	}
+
+	// The registry is not closed, so the session is suspended and waits for resumption.
+	if registry.sessions.count() != 1 {
+		t.Errorf("Expected 1 suspended session, but got %d", registry.sessions.count())
+	}
+
+	_ = registry.Close()
+
+	if registry.sessions.count() != 0 {
+		t.Errorf("Expected sessions to be expired on close, but got %d", registry.sessions.count())
+	}
+}
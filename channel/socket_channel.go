@@ -0,0 +1,194 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+const (
+	defaultSocketWriteTimeout   = 10 * time.Second
+	defaultSocketMaxMessageSize = frameSizeLimitInBytes
+)
+
+// SocketChannel is a channel for internal services that talk to the gateway over plain TCP or Unix sockets
+// without websocket overhead. It accepts connections on its own listener and frames messages
+// with a length prefix or a newline delimiter.
+// Connections are registered in the connection registry, so they share its limits and hooks,
+// and work with the same dispatchers, backends and middlewares.
+type SocketChannel struct {
+	listener     net.Listener
+	dispatcher   wasabi.Dispatcher
+	connRegistry ConnectionRegistrar
+	wg           *sync.WaitGroup
+	config       socketConfig
+}
+
+type socketConfig struct {
+	framing        SocketFraming
+	maxMessageSize int
+	writeTimeout   time.Duration
+	msgType        wasabi.MessageType
+}
+
+type SocketOption func(*socketConfig)
+
+// NewSocketChannel creates new instance of SocketChannel
+// listener - listener to accept connections on, e.g. created with net.Listen("tcp", ":9000") or net.Listen("unix", path)
+// dispatcher - dispatcher to use
+// connRegistry - connection registry to use
+func NewSocketChannel(
+	listener net.Listener,
+	dispatcher wasabi.Dispatcher,
+	connRegistry ConnectionRegistrar,
+	opts ...SocketOption,
+) *SocketChannel {
+	config := socketConfig{
+		framing:        FramingLengthPrefixed,
+		maxMessageSize: defaultSocketMaxMessageSize,
+		writeTimeout:   defaultSocketWriteTimeout,
+		msgType:        wasabi.MsgTypeText,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return &SocketChannel{
+		listener:     listener,
+		dispatcher:   dispatcher,
+		connRegistry: connRegistry,
+		wg:           &sync.WaitGroup{},
+		config:       config,
+	}
+}
+
+// Path returns the network address of the channel listener, the channel doesn't serve HTTP requests.
+func (c *SocketChannel) Path() string {
+	return c.listener.Addr().String()
+}
+
+// Handler returns http.Handler that responds with 404 (not found), the channel doesn't serve HTTP requests.
+func (c *SocketChannel) Handler() http.Handler {
+	return http.NotFoundHandler()
+}
+
+// Addr returns the network address of the channel listener.
+func (c *SocketChannel) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+// Serve accepts connections on the listener and handles them until the channel is closed.
+// The context is the base context for all connections of the channel.
+// It returns nil after the channel is closed, or the error of the listener otherwise.
+func (c *SocketChannel) Serve(ctx context.Context) error {
+	for {
+		netConn, err := c.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		c.wg.Add(1)
+
+		go func() {
+			defer c.wg.Done()
+
+			c.handleConnection(ctx, netConn)
+		}()
+	}
+}
+
+// Close stops accepting new connections and closes all connections of the channel by closing the underlying connection registry.
+// It waits for the connections to be closed until the context is done.
+func (c *SocketChannel) Close(ctx ...context.Context) error {
+	if err := c.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	if err := c.connRegistry.Close(ctx...); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	if len(ctx) == 0 {
+		<-done
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx[0].Done():
+		return ctx[0].Err()
+	}
+}
+
+// handleConnection registers the accepted connection and dispatches its messages until the connection is closed.
+func (c *SocketChannel) handleConnection(ctx context.Context, netConn net.Conn) {
+	if !c.connRegistry.CanAccept() {
+		_ = netConn.Close()
+		return
+	}
+
+	conn := newSocketConn(ctx, newConnectionID(c.connRegistry), netConn, c.config)
+
+	if err := c.connRegistry.Register(conn); err != nil {
+		slog.Debug("Rejecting socket connection", "remote_addr", netConn.RemoteAddr().String(), "error", err)
+
+		_ = conn.Close(websocket.StatusTryAgainLater, err.Error())
+
+		return
+	}
+
+	defer c.connRegistry.Unregister(conn)
+
+	conn.handleMessages(c.config.msgType, c.dispatcher.Dispatch)
+}
+
+// WithSocketFraming sets the framing of messages, the default framing is FramingLengthPrefixed.
+func WithSocketFraming(framing SocketFraming) SocketOption {
+	return func(c *socketConfig) {
+		c.framing = framing
+	}
+}
+
+// WithSocketMaxMessageSize sets the maximum size of messages in bytes.
+// The default size is 32768 bytes, the connection is closed if it receives a larger message.
+// Sent messages are not limited, so responses can be larger than requests.
+func WithSocketMaxMessageSize(size int) SocketOption {
+	return func(c *socketConfig) {
+		c.maxMessageSize = size
+	}
+}
+
+// WithSocketWriteTimeout sets the timeout for writing a single message to the connection.
+// The connection is closed if the peer doesn't read messages fast enough.
+// The default timeout is 10 seconds, if the timeout is 0, writes never time out.
+func WithSocketWriteTimeout(timeout time.Duration) SocketOption {
+	return func(c *socketConfig) {
+		c.writeTimeout = timeout
+	}
+}
+
+// WithSocketMessageType sets the message type incoming messages are dispatched with,
+// as message types are not transmitted over raw sockets. The default type is wasabi.MsgTypeText.
+func WithSocketMessageType(msgType wasabi.MessageType) SocketOption {
+	return func(c *socketConfig) {
+		c.msgType = msgType
+	}
+}
@@ -0,0 +1,363 @@
+package channel
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// startSocketChannel creates the socket channel with the echo dispatcher and serves it until the test ends.
+func startSocketChannel(t *testing.T, network, addr string, registry *ConnectionRegistry, opts ...SocketOption) *SocketChannel {
+	t.Helper()
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatalf("Unexpected error creating listener: %v", err)
+	}
+
+	dispatcher := mocks.NewMockDispatcher(t)
+	dispatcher.EXPECT().Dispatch(mock.Anything, mock.Anything, mock.Anything).Run(
+		func(conn wasabi.Connection, msgType wasabi.MessageType, data []byte) {
+			_ = conn.Send(msgType, data)
+		},
+	).Maybe()
+
+	channel := NewSocketChannel(listener, dispatcher, registry, opts...)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- channel.Serve(context.Background())
+	}()
+
+	t.Cleanup(func() {
+		_ = channel.Close()
+
+		if err := <-served; err != nil {
+			t.Errorf("Unexpected error serving channel: %v", err)
+		}
+	})
+
+	return channel
+}
+
+func writeFrame(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+
+	frame := make([]byte, lengthPrefixSize+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[lengthPrefixSize:], msg)
+
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Unexpected error writing frame: %v", err)
+	}
+}
+
+func readFrame(t *testing.T, conn net.Conn) string {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var prefix [lengthPrefixSize]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		t.Fatalf("Unexpected error reading frame: %v", err)
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(prefix[:]))
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatalf("Unexpected error reading frame: %v", err)
+	}
+
+	return string(data)
+}
+
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected connection to be closed, but got %v", err)
+	}
+}
+
+func TestNewSocketChannel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer listener.Close()
+
+	channel := NewSocketChannel(
+		listener,
+		mocks.NewMockDispatcher(t),
+		NewConnectionRegistry(),
+		WithSocketFraming(FramingNewline),
+		WithSocketMaxMessageSize(10),
+		WithSocketWriteTimeout(time.Minute),
+		WithSocketMessageType(wasabi.MsgTypeBinary),
+	)
+
+	if channel.Path() != listener.Addr().String() {
+		t.Errorf("Unexpected path: got %q, expected %q", channel.Path(), listener.Addr().String())
+	}
+
+	if channel.config.framing != FramingNewline {
+		t.Errorf("Unexpected framing: got %d, expected %d", channel.config.framing, FramingNewline)
+	}
+
+	if channel.config.maxMessageSize != 10 {
+		t.Errorf("Unexpected max message size: got %d, expected %d", channel.config.maxMessageSize, 10)
+	}
+
+	if channel.config.writeTimeout != time.Minute {
+		t.Errorf("Unexpected write timeout: got %v, expected %v", channel.config.writeTimeout, time.Minute)
+	}
+
+	if channel.config.msgType != wasabi.MsgTypeBinary {
+		t.Errorf("Unexpected message type: got %v, expected %v", channel.config.msgType, wasabi.MsgTypeBinary)
+	}
+}
+
+func TestSocketChannel_LengthPrefixed(t *testing.T) {
+	registry := NewConnectionRegistry()
+	channel := startSocketChannel(t, "tcp", "127.0.0.1:0", registry)
+
+	conn, err := net.Dial("tcp", channel.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer conn.Close()
+
+	writeFrame(t, conn, "hello\nworld")
+	writeFrame(t, conn, "")
+
+	if msg := readFrame(t, conn); msg != "hello\nworld" {
+		t.Errorf("Unexpected message: got %q, expected %q", msg, "hello\nworld")
+	}
+
+	if msg := readFrame(t, conn); msg != "" {
+		t.Errorf("Unexpected message: got %q, expected empty message", msg)
+	}
+
+	if registry.Count() != 1 {
+		t.Errorf("Expected connection to be registered, but got %d connections", registry.Count())
+	}
+}
+
+func TestSocketChannel_Newline(t *testing.T) {
+	registry := NewConnectionRegistry()
+	channel := startSocketChannel(t, "unix", filepath.Join(t.TempDir(), "wasabi.sock"), registry, WithSocketFraming(FramingNewline))
+
+	conn, err := net.Dial("unix", channel.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("first\r\nsecond\n")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+
+	for _, expected := range []string{"first\n", "second\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if line != expected {
+			t.Errorf("Unexpected message: got %q, expected %q", line, expected)
+		}
+	}
+}
+
+func TestSocketChannel_MessageTooLarge(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		framing SocketFraming
+	}{
+		{
+			name:    "length prefixed",
+			framing: FramingLengthPrefixed,
+			payload: []byte{0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'},
+		},
+		{
+			name:    "newline",
+			framing: FramingNewline,
+			payload: []byte("hello world\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := startSocketChannel(t, "tcp", "127.0.0.1:0", NewConnectionRegistry(), WithSocketFraming(tt.framing), WithSocketMaxMessageSize(4))
+
+			conn, err := net.Dial("tcp", channel.Addr().String())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			defer conn.Close()
+
+			if _, err := conn.Write(tt.payload); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expectClosed(t, conn)
+		})
+	}
+}
+
+func TestSocketChannel_ConnectionLimit(t *testing.T) {
+	disconnected := make(chan *wasabi.CloseInfo, 1)
+
+	registry := NewConnectionRegistry(
+		WithConnectionLimit(1),
+		WithOnDisconnectHook(func(_ wasabi.Connection, info *wasabi.CloseInfo) { disconnected <- info }),
+	)
+
+	channel := startSocketChannel(t, "tcp", "127.0.0.1:0", registry)
+
+	first, err := net.Dial("tcp", channel.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	writeFrame(t, first, "ping")
+	_ = readFrame(t, first)
+
+	second, err := net.Dial("tcp", channel.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer second.Close()
+
+	expectClosed(t, second)
+
+	first.Close()
+
+	select {
+	case info := <-disconnected:
+		if info == nil || info.Initiator != wasabi.ClosedByClient || info.Code != websocket.StatusNormalClosure {
+			t.Errorf("Unexpected close info: %+v", info)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected disconnect hook to be called")
+	}
+
+	if registry.Count() != 0 {
+		t.Errorf("Expected no connections, but got %d", registry.Count())
+	}
+}
+
+func TestSocketChannel_Close(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	registry := NewConnectionRegistry()
+	channel := NewSocketChannel(listener, mocks.NewMockDispatcher(t), registry)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- channel.Serve(context.Background())
+	}()
+
+	conn, err := net.Dial("tcp", channel.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	defer conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for registry.Count() != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := channel.Close(ctx); err != nil {
+		t.Fatalf("Unexpected error closing channel: %v", err)
+	}
+
+	expectClosed(t, conn)
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Unexpected error serving channel: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Serve to return after the channel is closed")
+	}
+
+	if registry.Count() != 0 {
+		t.Errorf("Expected no connections, but got %d", registry.Count())
+	}
+}
+
+func TestSocketConn_Send(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := newSocketConn(context.Background(), "conn1", server, socketConfig{framing: FramingNewline, maxMessageSize: 8})
+
+	if err := conn.Send(wasabi.MsgTypeText, []byte("a\nb")); err != ErrInvalidMessage {
+		t.Errorf("Expected error %v, but got %v", ErrInvalidMessage, err)
+	}
+
+	// The maximum message size limits only received messages
+	go func() { _ = conn.Send(wasabi.MsgTypeText, []byte("large message")) }()
+
+	reader := bufio.NewReader(client)
+
+	if line, err := reader.ReadString('\n'); err != nil || line != "large message\n" {
+		t.Errorf("Unexpected message: %q, error: %v", line, err)
+	}
+
+	go func() {
+		w, _ := conn.Writer(wasabi.MsgTypeText)
+		_, _ = w.Write([]byte("te"))
+		_, _ = w.Write([]byte("st"))
+		_ = w.Close()
+	}()
+
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "test\n" {
+		t.Errorf("Unexpected message: %q, error: %v", line, err)
+	}
+
+	if err := conn.Close(0, ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := conn.Send(wasabi.MsgTypeText, []byte("test")); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+
+	if err := conn.Close(0, ""); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+}
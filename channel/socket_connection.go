@@ -0,0 +1,330 @@
+package channel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+// SocketFraming defines how messages are delimited on raw socket connections.
+type SocketFraming int
+
+const (
+	// FramingLengthPrefixed prefixes every message with its length as 4 bytes unsigned big-endian integer.
+	FramingLengthPrefixed SocketFraming = iota
+	// FramingNewline terminates every message with \n, a trailing \r is stripped from incoming messages.
+	// Messages that contain \n can't be sent with this framing.
+	FramingNewline
+)
+
+const lengthPrefixSize = 4
+
+var (
+	// ErrMessageTooLarge is error for messages that exceed the maximum message size of the socket connection.
+	ErrMessageTooLarge = errors.New("message is too large")
+	// ErrInvalidMessage is error for messages that can't be framed, e.g. messages with \n with newline framing.
+	ErrInvalidMessage = errors.New("message can't be framed")
+)
+
+// SocketConn is a connection of the socket channel.
+// Messages are framed according to the framing of the channel, message types are not transmitted:
+// incoming messages are dispatched with the message type configured for the channel, and
+// the message type of outgoing messages is ignored.
+type SocketConn struct {
+	ctx            context.Context
+	ctxCancel      context.CancelCauseFunc
+	conn           net.Conn
+	attrs          *sync.Map
+	reqWG          *sync.WaitGroup
+	closeInfo      atomic.Pointer[wasabi.CloseInfo]
+	id             string
+	framing        SocketFraming
+	maxMessageSize int
+	writeTimeout   time.Duration
+	state          atomic.Int32
+	mu             sync.Mutex
+	reqMu          sync.Mutex
+}
+
+// newSocketConn creates new instance of SocketConn for the accepted network connection.
+func newSocketConn(ctx context.Context, id string, conn net.Conn, config socketConfig) *SocketConn {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	c := &SocketConn{
+		ctx:            ctx,
+		ctxCancel:      cancel,
+		conn:           conn,
+		attrs:          &sync.Map{},
+		reqWG:          &sync.WaitGroup{},
+		id:             id,
+		framing:        config.framing,
+		maxMessageSize: config.maxMessageSize,
+		writeTimeout:   config.writeTimeout,
+	}
+
+	for key, value := range wasabi.AttrsFromContext(ctx) {
+		c.attrs.Store(key, value)
+	}
+
+	return c
+}
+
+// ID returns the id of the connection.
+func (c *SocketConn) ID() string {
+	return c.id
+}
+
+// String returns the connection id.
+func (c *SocketConn) String() string {
+	return c.id
+}
+
+// Context returns the context of the connection, it's canceled when the connection is closed.
+func (c *SocketConn) Context() context.Context {
+	return c.ctx
+}
+
+// Attr returns value of the connection attribute with the given key.
+func (c *SocketConn) Attr(key string) (any, bool) {
+	return c.attrs.Load(key)
+}
+
+// SetAttr sets value of the connection attribute with the given key.
+func (c *SocketConn) SetAttr(key string, value any) {
+	c.attrs.Store(key, value)
+}
+
+// RemoteAddr returns the remote network address of the connection.
+func (c *SocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Send writes the framed message to the connection, the message type is ignored.
+// The maximum message size applies only to received messages, sent messages are limited only by the framing.
+func (c *SocketConn) Send(_ wasabi.MessageType, msg []byte) error {
+	if c.ctx.Err() != nil {
+		return ErrConnectionClosed
+	}
+
+	var frame []byte
+
+	switch c.framing {
+	case FramingNewline:
+		if bytes.IndexByte(msg, '\n') >= 0 {
+			return ErrInvalidMessage
+		}
+
+		frame = make([]byte, len(msg)+1)
+		copy(frame, msg)
+		frame[len(msg)] = '\n'
+	default:
+		if uint64(len(msg)) > math.MaxUint32 {
+			return ErrMessageTooLarge
+		}
+
+		frame = make([]byte, lengthPrefixSize+len(msg))
+		binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+		copy(frame[lengthPrefixSize:], msg)
+	}
+
+	return c.write(frame)
+}
+
+// Writer returns writer that collects the message in memory and sends it as a single frame when the writer is closed.
+func (c *SocketConn) Writer(msgType wasabi.MessageType) (io.WriteCloser, error) {
+	if c.ctx.Err() != nil {
+		return nil, ErrConnectionClosed
+	}
+
+	return newBufferedWriter(func(msg []byte) error {
+		return c.Send(msgType, msg)
+	}), nil
+}
+
+// Close closes the connection, the status code and the reason are not transmitted over raw sockets,
+// they are only recorded in the close info of the connection.
+// If a closing context is provided, it waits for messages that are being dispatched to complete until the context is done.
+func (c *SocketConn) Close(status websocket.StatusCode, reason string, closingCtx ...context.Context) error {
+	c.reqMu.Lock()
+	ok := c.state.CompareAndSwap(int32(connected), int32(closing))
+	c.reqMu.Unlock()
+
+	if !ok {
+		return ErrConnectionClosed
+	}
+
+	c.recordCloseInfo(serverClose(status, reason, nil))
+
+	if len(closingCtx) > 0 {
+		done := make(chan struct{})
+
+		go func() {
+			c.reqWG.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-closingCtx[0].Done():
+		case <-done:
+		}
+	}
+
+	c.terminate()
+
+	return nil
+}
+
+// handleMessages reads framed messages from the connection and dispatches them one by one in the order they are received,
+// until the connection is closed or a malformed frame is received.
+func (c *SocketConn) handleMessages(msgType wasabi.MessageType, cb wasabi.OnMessage) {
+	defer c.terminate()
+
+	reader := bufio.NewReader(c.conn)
+
+	for {
+		data, err := c.readMessage(reader)
+		if err != nil {
+			c.recordCloseInfo(socketReadCloseInfo(err))
+			return
+		}
+
+		if !c.startRequest() {
+			return
+		}
+
+		cb(c, msgType, data)
+		c.reqWG.Done()
+	}
+}
+
+// readMessage reads the next framed message from the reader.
+func (c *SocketConn) readMessage(reader *bufio.Reader) ([]byte, error) {
+	if c.framing == FramingNewline {
+		return c.readLine(reader)
+	}
+
+	var prefix [lengthPrefixSize]byte
+
+	if _, err := io.ReadFull(reader, prefix[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(prefix[:])
+	if uint64(size) > uint64(c.maxMessageSize) {
+		return nil, ErrMessageTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// readLine reads the next newline terminated message from the reader.
+func (c *SocketConn) readLine(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		data = append(data, chunk...)
+
+		if len(data) > c.maxMessageSize+2 {
+			return nil, ErrMessageTooLarge
+		}
+
+		switch {
+		case err == nil:
+			data = bytes.TrimSuffix(data[:len(data)-1], []byte("\r"))
+
+			if len(data) > c.maxMessageSize {
+				return nil, ErrMessageTooLarge
+			}
+
+			return data, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		default:
+			return nil, err
+		}
+	}
+}
+
+// CloseInfo returns how and why the connection was closed.
+// It returns nil until the connection starts closing.
+func (c *SocketConn) CloseInfo() *wasabi.CloseInfo {
+	return c.closeInfo.Load()
+}
+
+// recordCloseInfo records the close info if it's not recorded yet and returns the recorded close info.
+func (c *SocketConn) recordCloseInfo(info *wasabi.CloseInfo) *wasabi.CloseInfo {
+	return recordCloseInfo(&c.closeInfo, info)
+}
+
+// socketReadCloseInfo returns the close info for the error that stopped reading of the socket connection.
+func socketReadCloseInfo(err error) *wasabi.CloseInfo {
+	switch {
+	case errors.Is(err, io.EOF):
+		return clientGone(websocket.StatusNormalClosure, nil)
+	case errors.Is(err, ErrMessageTooLarge):
+		return serverClose(websocket.StatusMessageTooBig, "message too big", err)
+	default:
+		return clientGone(websocket.StatusAbnormalClosure, err)
+	}
+}
+
+// startRequest registers the message that is being dispatched, it returns false if the connection is closing.
+func (c *SocketConn) startRequest() bool {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+
+	if c.state.Load() != int32(connected) {
+		return false
+	}
+
+	c.reqWG.Add(1)
+
+	return true
+}
+
+// terminate closes the network connection and cancels the context of the connection.
+// Closing the network connection unblocks pending reads and writes.
+func (c *SocketConn) terminate() {
+	c.state.Store(int32(terminated))
+	c.ctxCancel(c.recordCloseInfo(serverClose(websocket.StatusAbnormalClosure, "", nil)))
+	_ = c.conn.Close()
+}
+
+// write writes the frame to the connection, if the write fails, the connection is closed.
+func (c *SocketConn) write(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx.Err() != nil {
+		return ErrConnectionClosed
+	}
+
+	if c.writeTimeout > 0 {
+		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	if _, err := c.conn.Write(frame); err != nil {
+		c.recordCloseInfo(clientGone(websocket.StatusAbnormalClosure, err))
+		c.terminate()
+		return ErrConnectionClosed
+	}
+
+	return nil
+}
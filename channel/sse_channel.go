@@ -0,0 +1,266 @@
+package channel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+)
+
+const (
+	// ConnectionIDParam is the query parameter of upstream POST requests with the id of the SSE connection.
+	ConnectionIDParam = "connection_id"
+	// ConnectionTokenParam is the query parameter of upstream POST requests with the upstream token of the SSE connection.
+	ConnectionTokenParam = "token"
+	// ConnectionTokenHeader is the header of upstream POST requests with the upstream token of the SSE connection,
+	// it can be used instead of the query parameter, so the token doesn't end up in access logs.
+	ConnectionTokenHeader = "X-Connection-Token"
+
+	defaultSSEKeepAlive      = 15 * time.Second
+	defaultSSEWriteTimeout   = 10 * time.Second
+	defaultSSEMaxMessageSize = frameSizeLimitInBytes
+)
+
+// SSEChannel is a channel for clients that can't use websockets, e.g. behind proxies that strip the upgrade.
+// Downstream messages are delivered over Server-Sent Events stream opened with a GET request,
+// upstream messages are sent with POST requests to the same path with the connection id and the upstream token,
+// which are sent to the client in the connected event.
+// Connections are registered in the connection registry, so they work with the same dispatchers, backends and middlewares.
+type SSEChannel struct {
+	dispatcher   wasabi.Dispatcher
+	connRegistry ConnectionRegistrar
+	path         string
+	middlewares  []Middlewere
+	config       sseConfig
+}
+
+type sseConfig struct {
+	keepAlive      time.Duration
+	writeTimeout   time.Duration
+	maxMessageSize int64
+}
+
+type SSEOption func(*sseConfig)
+
+// NewSSEChannel creates new instance of SSEChannel
+// path - channel path, it serves both the event stream and upstream messages
+// dispatcher - dispatcher to use
+// connRegistry - connection registry to use
+func NewSSEChannel(
+	path string,
+	dispatcher wasabi.Dispatcher,
+	connRegistry ConnectionRegistrar,
+	opts ...SSEOption,
+) *SSEChannel {
+	config := sseConfig{
+		keepAlive:      defaultSSEKeepAlive,
+		writeTimeout:   defaultSSEWriteTimeout,
+		maxMessageSize: defaultSSEMaxMessageSize,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return &SSEChannel{
+		path:         path,
+		dispatcher:   dispatcher,
+		connRegistry: connRegistry,
+		middlewares:  make([]Middlewere, 0),
+		config:       config,
+	}
+}
+
+// Path returns url path for channel
+func (c *SSEChannel) Path() string {
+	return c.path
+}
+
+// Handler returns http.Handler for channel
+func (c *SSEChannel) Handler() http.Handler {
+	return c.wrapMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			c.handleStream(w, r)
+		case http.MethodPost:
+			c.handleMessage(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+// Use adds middlewere to channel
+func (c *SSEChannel) Use(middlewere Middlewere) {
+	c.middlewares = append(c.middlewares, middlewere)
+}
+
+// Close closes all connections of the channel by closing the underlying connection registry.
+func (c *SSEChannel) Close(ctx ...context.Context) error {
+	return c.connRegistry.Close(ctx...)
+}
+
+// handleStream opens the event stream for the new connection and keeps it open until the connection is closed.
+func (c *SSEChannel) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !c.connRegistry.CanAccept() {
+		http.Error(w, "Connection limit reached", http.StatusServiceUnavailable)
+		return
+	}
+
+	if acceptor, ok := c.connRegistry.(RequestAcceptor); ok {
+		var status int
+
+		if r, status = acceptor.AcceptRequest(r); status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// The connection context is not canceled with the request context, so its cause is the close info of the connection.
+	conn := newSSEConn(context.WithoutCancel(r.Context()), newConnectionID(c.connRegistry), w, c.config.writeTimeout)
+
+	if err := c.connRegistry.Register(conn); err != nil {
+		status := websocket.StatusTryAgainLater
+		if errors.Is(err, ErrRegistryClosed) {
+			status = websocket.StatusServiceRestart
+		}
+
+		_ = conn.Close(status, err.Error())
+		conn.finish()
+
+		return
+	}
+
+	// The stream is finished before the connection is unregistered, so the disconnect hook sees the closed connection.
+	defer c.connRegistry.Unregister(conn)
+	defer conn.finish()
+
+	// The connection is registered before its id is sent, so the client can post messages as soon as it gets the id.
+	connected, err := json.Marshal(sseConnectedEvent{ID: conn.ID(), Token: conn.token})
+	if err != nil {
+		return
+	}
+
+	if err := conn.writeEvent(SSEEventConnected, connected); err != nil {
+		return
+	}
+
+	var keepAlive <-chan time.Time
+
+	if c.config.keepAlive > 0 {
+		ticker := time.NewTicker(c.config.keepAlive)
+		defer ticker.Stop()
+
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-r.Context().Done():
+			conn.recordCloseInfo(clientGone(websocket.StatusGoingAway, nil))
+			return
+		case <-keepAlive:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessage dispatches the upstream message on behalf of the connection from the query.
+// The request must carry the upstream token of the connection in the header or in the query,
+// requests with unknown connection id or wrong token are rejected the same way.
+// Messages with application/octet-stream content type are dispatched as binary, all others as text.
+// The request completes after the message is dispatched, responses are delivered over the event stream.
+func (c *SSEChannel) handleMessage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	token := r.Header.Get(ConnectionTokenHeader)
+	if token == "" {
+		token = query.Get(ConnectionTokenParam)
+	}
+
+	conn, ok := c.connRegistry.GetConnection(query.Get(ConnectionIDParam)).(*SSEConn)
+	if !ok || !conn.validToken(token) {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.config.maxMessageSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	if !conn.startRequest() {
+		http.Error(w, "Connection is closed", http.StatusGone)
+		return
+	}
+
+	defer conn.finishRequest()
+
+	msgType := wasabi.MsgTypeText
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/octet-stream") {
+		msgType = wasabi.MsgTypeBinary
+	}
+
+	c.dispatcher.Dispatch(conn, msgType, data)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// wrapMiddleware applies middlewares to handler
+func (c *SSEChannel) wrapMiddleware(handler http.Handler) http.Handler {
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		handler = c.middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// WithSSEKeepAlive sets the interval of keep-alive comments on the event stream, so proxies don't close idle streams.
+// The default interval is 15 seconds, if the interval is 0, keep-alive comments are disabled.
+func WithSSEKeepAlive(interval time.Duration) SSEOption {
+	return func(c *sseConfig) {
+		c.keepAlive = interval
+	}
+}
+
+// WithSSEWriteTimeout sets the timeout for writing a single event to the stream.
+// The connection is closed if the client doesn't read the stream fast enough.
+// The default timeout is 10 seconds.
+func WithSSEWriteTimeout(timeout time.Duration) SSEOption {
+	return func(c *sseConfig) {
+		c.writeTimeout = timeout
+	}
+}
+
+// WithSSEMaxMessageSize sets the maximum size of upstream messages in bytes.
+// The default size is 32768 bytes, larger messages are rejected with status 413 (request entity too large).
+func WithSSEMaxMessageSize(size int64) SSEOption {
+	return func(c *sseConfig) {
+		c.maxMessageSize = size
+	}
+}
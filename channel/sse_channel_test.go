@@ -0,0 +1,367 @@
+package channel
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// sseEvent is an event read from the event stream.
+type sseEvent struct {
+	event string
+	data  string
+}
+
+// readSSEEvent reads the next event from the event stream, comments are skipped.
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var (
+		ev    sseEvent
+		lines []string
+	)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected error reading event stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+			if lines == nil && ev.event == "" {
+				continue
+			}
+
+			ev.data = strings.Join(lines, "\n")
+
+			return ev
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+// openSSEStream opens the event stream and returns its reader and the connection id with the upstream token.
+func openSSEStream(t *testing.T, url string) (*http.Response, *bufio.Reader, sseConnectedEvent) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Unexpected error opening event stream: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status code: got %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Unexpected content type: got %q, expected %q", ct, "text/event-stream")
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	ev := readSSEEvent(t, reader)
+	if ev.event != SSEEventConnected {
+		t.Fatalf("Expected connected event, but got %+v", ev)
+	}
+
+	var connected sseConnectedEvent
+	if err := json.Unmarshal([]byte(ev.data), &connected); err != nil || connected.ID == "" || connected.Token == "" {
+		t.Fatalf("Expected connected event with connection id and token, but got %+v", ev)
+	}
+
+	return resp, reader, connected
+}
+
+func postSSEMessage(t *testing.T, url string, conn sseConnectedEvent, contentType, body string) int {
+	t.Helper()
+
+	query := neturl.Values{ConnectionIDParam: {conn.ID}, ConnectionTokenParam: {conn.Token}}
+
+	resp, err := http.Post(url+"?"+query.Encode(), contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error posting message: %v", err)
+	}
+
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestNewSSEChannel(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	registry := NewConnectionRegistry()
+
+	channel := NewSSEChannel("/sse", dispatcher, registry, WithSSEKeepAlive(time.Second), WithSSEWriteTimeout(time.Minute), WithSSEMaxMessageSize(10))
+
+	if channel.Path() != "/sse" {
+		t.Errorf("Unexpected path: got %q, expected %q", channel.Path(), "/sse")
+	}
+
+	if channel.config.keepAlive != time.Second {
+		t.Errorf("Unexpected keep-alive interval: got %v, expected %v", channel.config.keepAlive, time.Second)
+	}
+
+	if channel.config.writeTimeout != time.Minute {
+		t.Errorf("Unexpected write timeout: got %v, expected %v", channel.config.writeTimeout, time.Minute)
+	}
+
+	if channel.config.maxMessageSize != 10 {
+		t.Errorf("Unexpected max message size: got %d, expected %d", channel.config.maxMessageSize, 10)
+	}
+}
+
+func TestSSEChannel_Echo(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	dispatcher.EXPECT().Dispatch(mock.Anything, mock.Anything, mock.Anything).Run(
+		func(conn wasabi.Connection, msgType wasabi.MessageType, data []byte) {
+			_ = conn.Send(msgType, data)
+		},
+	)
+
+	registry := NewConnectionRegistry()
+	channel := NewSSEChannel("/", dispatcher, registry)
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	resp, reader, id := openSSEStream(t, server.URL)
+	defer resp.Body.Close()
+
+	if registry.Count() != 1 {
+		t.Errorf("Expected connection to be registered, but got %d connections", registry.Count())
+	}
+
+	if status := postSSEMessage(t, server.URL, id, "text/plain", "hello\nworld"); status != http.StatusAccepted {
+		t.Fatalf("Unexpected status code: got %d, expected %d", status, http.StatusAccepted)
+	}
+
+	if ev := readSSEEvent(t, reader); ev.event != "" || ev.data != "hello\nworld" {
+		t.Errorf("Unexpected text event: %+v", ev)
+	}
+
+	// The token can be passed in the header instead of the query
+	req, err := http.NewRequest(http.MethodPost, server.URL+"?"+ConnectionIDParam+"="+id.ID, strings.NewReader("\x00\x01"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(ConnectionTokenHeader, id.Token)
+
+	postResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error posting message: %v", err)
+	}
+
+	postResp.Body.Close()
+
+	if postResp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Unexpected status code: got %d, expected %d", postResp.StatusCode, http.StatusAccepted)
+	}
+
+	ev := readSSEEvent(t, reader)
+	if ev.event != SSEEventBinary {
+		t.Fatalf("Expected binary event, but got %+v", ev)
+	}
+
+	if data, err := base64.StdEncoding.DecodeString(ev.data); err != nil || string(data) != "\x00\x01" {
+		t.Errorf("Unexpected binary data: %q, error: %v", data, err)
+	}
+}
+
+func TestSSEChannel_HandleMessage_Errors(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	registry := NewConnectionRegistry()
+	channel := NewSSEChannel("/", dispatcher, registry, WithSSEMaxMessageSize(4))
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	resp, _, id := openSSEStream(t, server.URL)
+	defer resp.Body.Close()
+
+	if status := postSSEMessage(t, server.URL, sseConnectedEvent{ID: "unknown", Token: id.Token}, "text/plain", "test"); status != http.StatusNotFound {
+		t.Errorf("Unexpected status code for unknown connection: got %d, expected %d", status, http.StatusNotFound)
+	}
+
+	if status := postSSEMessage(t, server.URL, sseConnectedEvent{ID: id.ID, Token: "wrong"}, "text/plain", "test"); status != http.StatusNotFound {
+		t.Errorf("Unexpected status code for wrong token: got %d, expected %d", status, http.StatusNotFound)
+	}
+
+	if status := postSSEMessage(t, server.URL, sseConnectedEvent{ID: id.ID}, "text/plain", "test"); status != http.StatusNotFound {
+		t.Errorf("Unexpected status code for missing token: got %d, expected %d", status, http.StatusNotFound)
+	}
+
+	if status := postSSEMessage(t, server.URL, id, "text/plain", "too large"); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status code for large message: got %d, expected %d", status, http.StatusRequestEntityTooLarge)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, http.NoBody)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	putResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	putResp.Body.Close()
+
+	if putResp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status code for PUT: got %d, expected %d", putResp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestSSEChannel_Close(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+	registry := NewConnectionRegistry()
+	channel := NewSSEChannel("/", dispatcher, registry)
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	resp, reader, _ := openSSEStream(t, server.URL)
+	defer resp.Body.Close()
+
+	if err := channel.Close(); err != nil {
+		t.Fatalf("Unexpected error closing channel: %v", err)
+	}
+
+	ev := readSSEEvent(t, reader)
+	if ev.event != SSEEventClose || !strings.Contains(ev.data, `"code":1012`) {
+		t.Errorf("Expected close event with status 1012, but got %+v", ev)
+	}
+
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Error("Expected event stream to be closed")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for registry.Count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if registry.Count() != 0 {
+		t.Error("Expected connection to be unregistered")
+	}
+
+	// New streams are rejected after the registry is closed
+	rejected, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rejected.Body.Close()
+
+	if rejected.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status code: got %d, expected %d", rejected.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSSEChannel_ClientDisconnect(t *testing.T) {
+	dispatcher := mocks.NewMockDispatcher(t)
+
+	disconnected := make(chan string, 1)
+	registry := NewConnectionRegistry(WithOnDisconnectHook(func(conn wasabi.Connection, info *wasabi.CloseInfo) {
+		if info == nil || info.Initiator != wasabi.ClosedByClient || info.Code != websocket.StatusGoingAway {
+			t.Errorf("Unexpected close info: %+v", info)
+		}
+
+		if context.Cause(conn.Context()) != info {
+			t.Errorf("Expected connection context to be canceled with close info, but got %v", context.Cause(conn.Context()))
+		}
+
+		disconnected <- conn.ID()
+	}))
+
+	channel := NewSSEChannel("/", dispatcher, registry)
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	resp, _, id := openSSEStream(t, server.URL)
+	resp.Body.Close()
+
+	select {
+	case got := <-disconnected:
+		if got != id.ID {
+			t.Errorf("Unexpected disconnected connection: got %s, expected %s", got, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected connection to be unregistered after the client disconnects")
+	}
+}
+
+func TestSSEConn_Close(t *testing.T) {
+	rec := httptest.NewRecorder()
+	conn := newSSEConn(context.Background(), "conn1", rec, 0)
+
+	if err := conn.Close(websocket.StatusNormalClosure, "bye"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.Contains(rec.Body.String(), "event: close\ndata: {\"reason\":\"bye\",\"code\":1000}\n\n") {
+		t.Errorf("Unexpected close event: %q", rec.Body.String())
+	}
+
+	if conn.Context().Err() == nil {
+		t.Error("Expected connection context to be canceled")
+	}
+
+	if info := conn.CloseInfo(); info == nil || info.Initiator != wasabi.ClosedByServer || info.Reason != "bye" {
+		t.Errorf("Unexpected close info: %+v", info)
+	}
+
+	if err := conn.Close(websocket.StatusNormalClosure, ""); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+
+	if err := conn.Send(wasabi.MsgTypeText, []byte("test")); err != ErrConnectionClosed {
+		t.Errorf("Expected error %v, but got %v", ErrConnectionClosed, err)
+	}
+}
+
+func TestSSEConn_Writer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	conn := newSSEConn(wasabi.ContextWithAttrs(context.Background(), map[string]any{"user": "1"}), "conn1", rec, 0)
+
+	if user, ok := wasabi.GetAttr[string](conn, "user"); !ok || user != "1" {
+		t.Errorf("Expected attribute from context, but got %q", user)
+	}
+
+	w, err := conn.Writer(wasabi.MsgTypeText)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, _ = w.Write([]byte("test "))
+	_, _ = w.Write([]byte("message"))
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if rec.Body.String() != "data: test message\n\n" {
+		t.Errorf("Unexpected event: %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,275 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/ksysoev/wasabi"
+)
+
+const (
+	// SSEEventConnected is the event that is sent first on the stream, its data is JSON object with the id
+	// of the connection and the upstream token, both must be passed with upstream messages.
+	SSEEventConnected = "connected"
+	// SSEEventBinary is the event for binary messages, its data is the message encoded in standard base64.
+	SSEEventBinary = "binary"
+	// SSEEventClose is the event that is sent before the stream is closed by the server,
+	// its data is JSON object with the close code and reason.
+	SSEEventClose = "close"
+)
+
+// sseConnectedEvent is data of the connected event.
+type sseConnectedEvent struct {
+	ID    string `json:"connection_id"`
+	Token string `json:"token"`
+}
+
+// sseCloseEvent is data of the close event.
+type sseCloseEvent struct {
+	Reason string               `json:"reason"`
+	Code   websocket.StatusCode `json:"code"`
+}
+
+// SSEConn is a connection of the SSE channel.
+// Downstream messages are written to the event stream of the GET request,
+// upstream messages arrive with separate POST requests and are dispatched on behalf of this connection.
+type SSEConn struct {
+	ctx          context.Context
+	ctxCancel    context.CancelCauseFunc
+	w            io.Writer
+	rc           *http.ResponseController
+	attrs        *sync.Map
+	reqWG        *sync.WaitGroup
+	closeInfo    atomic.Pointer[wasabi.CloseInfo]
+	id           string
+	token        string
+	writeTimeout time.Duration
+	state        atomic.Int32
+	mu           sync.Mutex
+	finished     bool
+}
+
+// newSSEConn creates new instance of SSEConn for the event stream.
+func newSSEConn(ctx context.Context, id string, w http.ResponseWriter, writeTimeout time.Duration) *SSEConn {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	conn := &SSEConn{
+		ctx:          ctx,
+		ctxCancel:    cancel,
+		w:            w,
+		rc:           http.NewResponseController(w),
+		attrs:        &sync.Map{},
+		reqWG:        &sync.WaitGroup{},
+		id:           id,
+		token:        uuid.New().String(),
+		writeTimeout: writeTimeout,
+	}
+
+	for key, value := range wasabi.AttrsFromContext(ctx) {
+		conn.attrs.Store(key, value)
+	}
+
+	return conn
+}
+
+// ID returns the id of the connection.
+func (c *SSEConn) ID() string {
+	return c.id
+}
+
+// String returns the connection id.
+func (c *SSEConn) String() string {
+	return c.id
+}
+
+// validToken reports whether the upstream token matches the token of the connection.
+// Connection ids are not secret, so the token is what proves that the request comes from the client of the stream.
+func (c *SSEConn) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.token)) == 1
+}
+
+// Context returns the context of the connection, it's canceled when the event stream is closed.
+func (c *SSEConn) Context() context.Context {
+	return c.ctx
+}
+
+// Attr returns value of the connection attribute with the given key.
+func (c *SSEConn) Attr(key string) (any, bool) {
+	return c.attrs.Load(key)
+}
+
+// SetAttr sets value of the connection attribute with the given key.
+func (c *SSEConn) SetAttr(key string, value any) {
+	c.attrs.Store(key, value)
+}
+
+// Send writes the message to the event stream.
+// Text messages are sent as default message events, binary messages are sent as binary events encoded in base64.
+// Line breaks in text messages are normalized to \n by the SSE format.
+func (c *SSEConn) Send(msgType wasabi.MessageType, msg []byte) error {
+	if msgType == wasabi.MsgTypeBinary {
+		data := make([]byte, base64.StdEncoding.EncodedLen(len(msg)))
+		base64.StdEncoding.Encode(data, msg)
+
+		return c.writeEvent(SSEEventBinary, data)
+	}
+
+	return c.writeEvent("", msg)
+}
+
+// Writer returns writer that collects the message in memory and sends it when the writer is closed,
+// SSE events can't be written partially.
+func (c *SSEConn) Writer(msgType wasabi.MessageType) (io.WriteCloser, error) {
+	if c.ctx.Err() != nil {
+		return nil, ErrConnectionClosed
+	}
+
+	return newBufferedWriter(func(msg []byte) error {
+		return c.Send(msgType, msg)
+	}), nil
+}
+
+// Close closes the connection with the specified status code and reason.
+// If a closing context is provided, it waits for pending upstream requests to complete until the context is done.
+// The close event is sent to the client before the event stream is closed.
+func (c *SSEConn) Close(status websocket.StatusCode, reason string, closingCtx ...context.Context) error {
+	if !c.state.CompareAndSwap(int32(connected), int32(closing)) {
+		return ErrConnectionClosed
+	}
+
+	info := c.recordCloseInfo(serverClose(status, reason, nil))
+
+	if len(closingCtx) > 0 {
+		done := make(chan struct{})
+
+		go func() {
+			c.reqWG.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-closingCtx[0].Done():
+		case <-done:
+		}
+	}
+
+	data, err := json.Marshal(sseCloseEvent{Code: info.Code, Reason: info.Reason})
+	if err == nil {
+		_ = c.writeEvent(SSEEventClose, data)
+	}
+
+	c.state.Store(int32(terminated))
+	c.ctxCancel(info)
+
+	return nil
+}
+
+// CloseInfo returns how and why the connection was closed.
+// It returns nil until the connection starts closing.
+func (c *SSEConn) CloseInfo() *wasabi.CloseInfo {
+	return c.closeInfo.Load()
+}
+
+// recordCloseInfo records the close info if it's not recorded yet and returns the recorded close info.
+func (c *SSEConn) recordCloseInfo(info *wasabi.CloseInfo) *wasabi.CloseInfo {
+	return recordCloseInfo(&c.closeInfo, info)
+}
+
+// startRequest registers the upstream request, it returns false if the connection is closing.
+func (c *SSEConn) startRequest() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.finished || c.state.Load() != int32(connected) {
+		return false
+	}
+
+	c.reqWG.Add(1)
+
+	return true
+}
+
+// finishRequest marks the upstream request as completed.
+func (c *SSEConn) finishRequest() {
+	c.reqWG.Done()
+}
+
+// ping writes a comment to the event stream, so proxies don't close the idle stream.
+func (c *SSEConn) ping() error {
+	return c.write([]byte(": ping\n\n"))
+}
+
+// finish marks the event stream as finished, after that nothing can be written to it.
+// It's called when the stream handler returns, as the response writer can't be used after that.
+func (c *SSEConn) finish() {
+	c.ctxCancel(c.recordCloseInfo(serverClose(websocket.StatusAbnormalClosure, "", nil)))
+
+	c.mu.Lock()
+	c.finished = true
+	c.mu.Unlock()
+
+	c.state.Store(int32(terminated))
+}
+
+// writeEvent formats the event and writes it to the event stream.
+func (c *SSEConn) writeEvent(event string, data []byte) error {
+	var buf bytes.Buffer
+
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+
+	return c.write(buf.Bytes())
+}
+
+// write writes the raw data to the event stream and flushes it.
+// If the write fails, the connection is considered closed.
+func (c *SSEConn) write(data []byte) error {
+	if c.ctx.Err() != nil {
+		return ErrConnectionClosed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.finished {
+		return ErrConnectionClosed
+	}
+
+	if c.writeTimeout > 0 {
+		_ = c.rc.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	if _, err := c.w.Write(data); err != nil {
+		c.ctxCancel(c.recordCloseInfo(clientGone(websocket.StatusAbnormalClosure, err)))
+		return ErrConnectionClosed
+	}
+
+	if err := c.rc.Flush(); err != nil {
+		c.ctxCancel(c.recordCloseInfo(clientGone(websocket.StatusAbnormalClosure, err)))
+		return ErrConnectionClosed
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package channel
+
+import (
+	"io"
+	"sync"
+)
+
+// messageStream is a reader over a single incoming message that is read from the websocket as it arrives.
+// The connection can't read the next message until the current one is consumed,
+// so done is closed as soon as the message is read to the end, failed or discarded.
+type messageStream struct {
+	reader io.Reader
+	err    error
+	done   chan struct{}
+	n      int
+	mu     sync.Mutex
+}
+
+// newMessageStream creates new instance of messageStream
+func newMessageStream(reader io.Reader) *messageStream {
+	return &messageStream{
+		reader: reader,
+		done:   make(chan struct{}),
+	}
+}
+
+// Read reads the message from the websocket.
+// After the message is consumed, Read returns the final error without touching the websocket.
+func (s *messageStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reader == nil {
+		return 0, s.err
+	}
+
+	n, err := s.reader.Read(p)
+	s.n += n
+
+	if err != nil {
+		s.finishLocked(err)
+	}
+
+	return n, err
+}
+
+// discard reads and drops the rest of the message, it's called after the handler returns.
+func (s *messageStream) discard() {
+	_, _ = io.Copy(io.Discard, s)
+}
+
+// finishLocked releases the websocket reader, the caller must hold the lock.
+func (s *messageStream) finishLocked(err error) {
+	s.reader = nil
+	s.err = err
+
+	close(s.done)
+}
+
+// result returns the error that finished the stream, io.EOF means the message was read to the end.
+func (s *messageStream) result() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// size returns number of bytes read from the message so far.
+func (s *messageStream) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.n
+}
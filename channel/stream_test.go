@@ -0,0 +1,78 @@
+package channel
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMessageStream_Read(t *testing.T) {
+	stream := newMessageStream(strings.NewReader("test message"))
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(data) != "test message" {
+		t.Errorf("Expected %q, but got %q", "test message", string(data))
+	}
+
+	select {
+	case <-stream.done:
+	default:
+		t.Error("Expected stream to be done after reading to the end")
+	}
+
+	if err := stream.result(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected result %v, but got %v", io.EOF, err)
+	}
+
+	// Reading after the end doesn't touch the underlying reader
+	if n, err := stream.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("Expected 0 bytes and EOF, but got %d bytes and %v", n, err)
+	}
+}
+
+func TestMessageStream_Discard(t *testing.T) {
+	stream := newMessageStream(strings.NewReader("test message"))
+
+	buf := make([]byte, 4)
+	if _, err := stream.Read(buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case <-stream.done:
+		t.Fatal("Expected stream not to be done before it's consumed")
+	default:
+	}
+
+	stream.discard()
+
+	select {
+	case <-stream.done:
+	default:
+		t.Error("Expected stream to be done after discard")
+	}
+}
+
+func TestMessageStream_Error(t *testing.T) {
+	expectedErr := errors.New("read error")
+	stream := newMessageStream(io.MultiReader(strings.NewReader("partial"), &failingReader{err: expectedErr}))
+
+	stream.discard()
+
+	if err := stream.result(); !errors.Is(err, expectedErr) {
+		t.Errorf("Expected result %v, but got %v", expectedErr, err)
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
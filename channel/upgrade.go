@@ -0,0 +1,110 @@
+package channel
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// UpgradeHook is called for every handshake request before the connection is upgraded to websocket.
+// It returns the result to accept the request with, nil result accepts the request as is.
+// To reject the request, it returns UpgradeRejection error, other errors reject the request
+// with status 500 (internal server error).
+type UpgradeHook func(r *http.Request) (*UpgradeResult, error)
+
+// UpgradeResult defines how the accepted connection is set up.
+type UpgradeResult struct {
+	// Attributes are initial attributes of the connection, see wasabi.ContextWithAttrs.
+	Attributes map[string]any
+	// Header is added to the handshake response.
+	Header http.Header
+	// Dispatcher overrides the dispatcher of the channel and of the negotiated subprotocol for the connection.
+	Dispatcher wasabi.Dispatcher
+}
+
+// UpgradeRejection is error returned by UpgradeHook to reject the handshake request
+// with the given HTTP status and response body.
+type UpgradeRejection struct {
+	Body   string
+	Status int
+}
+
+// RejectUpgrade returns UpgradeRejection error with the given HTTP status and response body.
+// If body is empty, the status text is used.
+func RejectUpgrade(status int, body string) *UpgradeRejection {
+	return &UpgradeRejection{
+		Status: status,
+		Body:   body,
+	}
+}
+
+// Error returns the error message.
+func (e *UpgradeRejection) Error() string {
+	return "upgrade rejected with status " + strconv.Itoa(e.Status)
+}
+
+// write writes the rejection response.
+func (e *UpgradeRejection) write(w http.ResponseWriter) {
+	body := e.Body
+	if body == "" {
+		body = http.StatusText(e.Status)
+	}
+
+	http.Error(w, body, e.Status)
+}
+
+// upgrade runs the OnUpgrade hook for the handshake request.
+// It returns the request with the connection attributes in the context and the dispatcher override,
+// or false if the request was rejected and the response is already written.
+func (c *Channel) upgrade(w http.ResponseWriter, r *http.Request) (*http.Request, wasabi.Dispatcher, bool) {
+	if c.config.onUpgrade == nil {
+		return r, nil, true
+	}
+
+	result, err := c.config.onUpgrade(r)
+	if err != nil {
+		var rejection *UpgradeRejection
+		if errors.As(err, &rejection) {
+			rejection.write(w)
+			return nil, nil, false
+		}
+
+		slog.Error("Error in upgrade hook: " + err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return nil, nil, false
+	}
+
+	if result == nil {
+		return r, nil, true
+	}
+
+	header := w.Header()
+
+	for key, values := range result.Header {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	if len(result.Attributes) > 0 {
+		r = r.WithContext(wasabi.ContextWithAttrs(r.Context(), result.Attributes))
+	}
+
+	return r, result.Dispatcher, true
+}
+
+// WithOnUpgrade sets the hook that is called for every handshake request before the connection is upgraded.
+// It's the place for authentication, versioning and tenant selection:
+// the hook can reject the request with RejectUpgrade, or accept it with initial connection attributes,
+// handshake response headers and a dispatcher for the connection.
+// The hook is called after the connection limit and subprotocol checks, and before the per-key connection limit,
+// so the key function can use the attributes from the request context.
+func WithOnUpgrade(hook UpgradeHook) Option {
+	return func(c *channelConfig) {
+		c.onUpgrade = hook
+	}
+}
@@ -0,0 +1,153 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestChannel_WithOnUpgrade_Reject(t *testing.T) {
+	tests := []struct {
+		err          error
+		name         string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			name:         "rejection",
+			err:          RejectUpgrade(http.StatusUnauthorized, "invalid token"),
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: "invalid token\n",
+		},
+		{
+			name:         "rejection without body",
+			err:          RejectUpgrade(http.StatusForbidden, ""),
+			expectedCode: http.StatusForbidden,
+			expectedBody: "Forbidden\n",
+		},
+		{
+			name:         "other error",
+			err:          errors.New("database is down"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBody: "Internal Server Error\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connRegistry := mocks.NewMockConnectionRegistry(t)
+			connRegistry.EXPECT().CanAccept().Return(true)
+
+			channel := NewChannel("/", mocks.NewMockDispatcher(t), connRegistry, WithOnUpgrade(func(_ *http.Request) (*UpgradeResult, error) {
+				return nil, tt.err
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			w := httptest.NewRecorder()
+
+			channel.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.expectedCode {
+				t.Errorf("Unexpected status code: got %d, expected %d", w.Code, tt.expectedCode)
+			}
+
+			if body, _ := io.ReadAll(w.Body); string(body) != tt.expectedBody {
+				t.Errorf("Unexpected body: got %q, expected %q", body, tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestChannel_WithOnUpgrade_Accept(t *testing.T) {
+	defaultDispatcher := mocks.NewMockDispatcher(t)
+	tenantDispatcher := mocks.NewMockDispatcher(t)
+
+	received := make(chan string, 1)
+
+	tenantDispatcher.EXPECT().Dispatch(mock.Anything, wasabi.MsgTypeText, []byte("hello")).Run(func(conn wasabi.Connection, _ wasabi.MessageType, _ []byte) {
+		tenant, _ := wasabi.GetAttr[string](conn, "tenant")
+		received <- tenant
+	})
+
+	registry := NewConnectionRegistry()
+	channel := NewChannel("/", defaultDispatcher, registry, WithOnUpgrade(func(r *http.Request) (*UpgradeResult, error) {
+		return &UpgradeResult{
+			Attributes: map[string]any{"tenant": r.URL.Query().Get("tenant")},
+			Header:     http.Header{"X-Api-Version": []string{"2"}},
+			Dispatcher: tenantDispatcher,
+		}, nil
+	}))
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String()+"/?tenant=acme", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	if version := resp.Header.Get("X-Api-Version"); version != "2" {
+		t.Errorf("Unexpected response header: got %q, expected %q", version, "2")
+	}
+
+	if err := ws.Write(context.Background(), websocket.MessageText, []byte("hello")); err != nil {
+		t.Fatalf("Unexpected error writing to websocket: %v", err)
+	}
+
+	select {
+	case tenant := <-received:
+		if tenant != "acme" {
+			t.Errorf("Unexpected tenant attribute: got %q, expected %q", tenant, "acme")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected message to be dispatched with the dispatcher from the upgrade hook")
+	}
+
+	// The mock keeps the connection as a call argument, so it must be closed before the mock is asserted
+	_ = ws.CloseNow()
+
+	assert.Eventually(t, func() bool { return registry.Count() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestChannel_WithOnUpgrade_KeyFromAttributes(t *testing.T) {
+	registry := NewConnectionRegistry(WithConnectionLimitPerKey(1, func(r *http.Request) string {
+		tenant, _ := wasabi.AttrsFromContext(r.Context())["tenant"].(string)
+		return tenant
+	}))
+
+	channel := NewChannel("/", mocks.NewMockDispatcher(t), registry, WithOnUpgrade(func(_ *http.Request) (*UpgradeResult, error) {
+		return &UpgradeResult{Attributes: map[string]any{"tenant": "acme"}}, nil
+	}))
+
+	server := httptest.NewServer(channel.Handler())
+	defer server.Close()
+
+	ws, resp, err := websocket.Dial(context.Background(), "ws://"+server.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error dialing websocket: %v", err)
+	}
+
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	defer func() { _ = ws.CloseNow() }()
+
+	assert.Eventually(t, func() bool { return registry.KeyConnections("acme") == 1 }, time.Second, 10*time.Millisecond)
+}
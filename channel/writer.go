@@ -0,0 +1,71 @@
+package channel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// ErrWriterClosed is error for writes to the message writer that is already closed
+var ErrWriterClosed = errors.New("message writer is closed")
+
+// connWriter streams a single message to the websocket and maps write errors to the errors of the connection.
+type connWriter struct {
+	writer io.WriteCloser
+}
+
+// Write writes the next part of the message.
+func (w *connWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	return n, mapWriteError(err)
+}
+
+// Close flushes the last frame of the message.
+func (w *connWriter) Close() error {
+	return mapWriteError(w.writer.Close())
+}
+
+// bufferedWriter collects the message in memory and sends it as a whole when it's closed.
+// It's used when the message can't be streamed directly to the websocket,
+// e.g. when it has to go through the send queue, the session replay buffer or a send wrapper.
+type bufferedWriter struct {
+	send   func(msg []byte) error
+	buf    bytes.Buffer
+	closed bool
+}
+
+// newBufferedWriter creates new instance of bufferedWriter
+func newBufferedWriter(send func(msg []byte) error) *bufferedWriter {
+	return &bufferedWriter{send: send}
+}
+
+// Write appends the data to the message.
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	return w.buf.Write(p)
+}
+
+// Close sends the collected message.
+func (w *bufferedWriter) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	w.closed = true
+
+	return w.send(w.buf.Bytes())
+}
+
+// mapWriteError converts errors of the closed websocket to ErrConnectionClosed.
+func mapWriteError(err error) error {
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, net.ErrClosed) {
+		return ErrConnectionClosed
+	}
+
+	return err
+}
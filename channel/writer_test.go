@@ -0,0 +1,66 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	var sent []byte
+
+	w := newBufferedWriter(func(msg []byte) error {
+		sent = msg
+		return nil
+	})
+
+	if _, err := w.Write([]byte("test ")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := w.Write([]byte("message")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sent != nil {
+		t.Error("Expected message not to be sent before the writer is closed")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(sent) != "test message" {
+		t.Errorf("Expected message %q, but got %q", "test message", string(sent))
+	}
+
+	if _, err := w.Write([]byte("more")); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Expected error %v, but got %v", ErrWriterClosed, err)
+	}
+
+	if err := w.Close(); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Expected error %v, but got %v", ErrWriterClosed, err)
+	}
+}
+
+func TestMapWriteError(t *testing.T) {
+	otherErr := errors.New("other error")
+
+	tests := []struct {
+		err      error
+		expected error
+	}{
+		{err: nil, expected: nil},
+		{err: fmt.Errorf("write: %w", syscall.EPIPE), expected: ErrConnectionClosed},
+		{err: fmt.Errorf("write: %w", net.ErrClosed), expected: ErrConnectionClosed},
+		{err: otherErr, expected: otherErr},
+	}
+
+	for _, tt := range tests {
+		if err := mapWriteError(tt.err); !errors.Is(err, tt.expected) {
+			t.Errorf("Expected error %v for %v, but got %v", tt.expected, tt.err, err)
+		}
+	}
+}
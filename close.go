@@ -0,0 +1,61 @@
+package wasabi
+
+import (
+	"strconv"
+
+	"github.com/coder/websocket"
+)
+
+// CloseInitiator is the side that initiated closing of the connection.
+type CloseInitiator int
+
+const (
+	// ClosedByServer means the connection was closed by the server, e.g. on shutdown, timeout or policy violation.
+	ClosedByServer CloseInitiator = iota
+	// ClosedByClient means the connection was closed by the client, or the client went away.
+	ClosedByClient
+)
+
+// String returns name of the side that initiated the close.
+func (i CloseInitiator) String() string {
+	if i == ClosedByClient {
+		return "client"
+	}
+
+	return "server"
+}
+
+// CloseInfo describes how and why the connection was closed.
+// It implements error, so it's used as the cause of the connection context cancellation
+// and can be retrieved with context.Cause(conn.Context()).
+type CloseInfo struct {
+	// Err is the underlying error that caused the close, e.g. read error or inactivity timeout, it's nil for regular closes.
+	Err error
+	// Reason is the close reason sent or received with the close status.
+	Reason string
+	// Code is the close status sent or received, websocket.StatusAbnormalClosure means
+	// the connection was lost without the closing handshake.
+	Code websocket.StatusCode
+	// Initiator is the side that initiated the close.
+	Initiator CloseInitiator
+}
+
+// Error returns description of the close, the underlying error is omitted if it only repeats the reason.
+func (i *CloseInfo) Error() string {
+	msg := "connection closed by " + i.Initiator.String() + " with status " + strconv.Itoa(int(i.Code))
+
+	if i.Reason != "" {
+		msg += ": " + i.Reason
+	}
+
+	if i.Err != nil && i.Err.Error() != i.Reason {
+		msg += ": " + i.Err.Error()
+	}
+
+	return msg
+}
+
+// Unwrap returns the underlying error of the close.
+func (i *CloseInfo) Unwrap() error {
+	return i.Err
+}
@@ -2,6 +2,7 @@ package dispatch
 
 import (
 	"context"
+	"io"
 
 	"github.com/ksysoev/wasabi"
 )
@@ -18,3 +19,5 @@ func (f RequestHandlerFunc) Handle(conn wasabi.Connection, req wasabi.Request) e
 }
 
 type RequestParser func(conn wasabi.Connection, ctx context.Context, msgType wasabi.MessageType, data []byte) wasabi.Request
+
+type StreamRequestParser func(conn wasabi.Connection, ctx context.Context, msgType wasabi.MessageType, r io.Reader) wasabi.Request
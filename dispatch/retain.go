@@ -0,0 +1,70 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// retainedRequest is a request with the payload borrowed from the connection until Release is called.
+type retainedRequest struct {
+	wasabi.Request
+	release func()
+	once    *sync.Once
+}
+
+// RetainRequest keeps the payload of the request valid after the handler returns, until Release is called.
+// It's meant for handlers that process the request asynchronously, e.g. publish it to a queue later.
+// Release must be called when the request is not used anymore, calling it more than once is a no-op.
+func RetainRequest(conn wasabi.Connection, req wasabi.Request) wasabi.ReleasableRequest {
+	return &retainedRequest{
+		Request: req,
+		release: wasabi.RetainPayload(conn, req.Data()),
+		once:    &sync.Once{},
+	}
+}
+
+// Release returns the payload of the request to the connection.
+func (r *retainedRequest) Release() {
+	r.once.Do(r.release)
+}
+
+// WithContext returns the retained request with the new context, it shares the payload with the original request.
+func (r *retainedRequest) WithContext(ctx context.Context) wasabi.Request {
+	return &retainedRequest{
+		Request: r.Request.WithContext(ctx),
+		release: r.release,
+		once:    r.once,
+	}
+}
+
+// copiedRequest is a request with its own copy of the payload.
+type copiedRequest struct {
+	wasabi.Request
+	data []byte
+}
+
+// CopyRequest returns the request with its own copy of the payload that can be used after the handler returns.
+// It's simpler than RetainRequest when the payload is small, as there is nothing to release.
+// Only Data of the returned request is copied, other fields of parsed requests may still point to the original payload.
+func CopyRequest(req wasabi.Request) wasabi.Request {
+	return &copiedRequest{
+		Request: req,
+		data:    bytes.Clone(req.Data()),
+	}
+}
+
+// Data returns the copy of the payload.
+func (r *copiedRequest) Data() []byte {
+	return r.data
+}
+
+// WithContext returns the copied request with the new context.
+func (r *copiedRequest) WithContext(ctx context.Context) wasabi.Request {
+	return &copiedRequest{
+		Request: r.Request.WithContext(ctx),
+		data:    r.data,
+	}
+}
@@ -0,0 +1,91 @@
+package dispatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+)
+
+// retainerConn is a connection that counts retained payloads.
+type retainerConn struct {
+	*mocks.MockConnection
+	retained int
+	released int
+}
+
+func (c *retainerConn) RetainPayload([]byte) func() {
+	c.retained++
+
+	return func() { c.released++ }
+}
+
+func TestRetainRequest(t *testing.T) {
+	conn := &retainerConn{MockConnection: mocks.NewMockConnection(t)}
+	req := NewRawRequest(context.Background(), wasabi.MsgTypeText, []byte("test data"))
+
+	retained := RetainRequest(conn, req)
+
+	if conn.retained != 1 {
+		t.Errorf("Expected payload to be retained once, but got %d", conn.retained)
+	}
+
+	if string(retained.Data()) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", retained.Data())
+	}
+
+	ctx := context.WithValue(context.Background(), struct{}{}, "value")
+
+	withCtx, ok := retained.WithContext(ctx).(wasabi.ReleasableRequest)
+	if !ok {
+		t.Fatal("Expected request with new context to be releasable")
+	}
+
+	if withCtx.Context() != ctx {
+		t.Errorf("Expected context to be %v, but got %v", ctx, withCtx.Context())
+	}
+
+	retained.Release()
+	withCtx.Release()
+
+	if conn.released != 1 {
+		t.Errorf("Expected payload to be released once, but got %d", conn.released)
+	}
+}
+
+func TestRetainRequest_NotRetainer(t *testing.T) {
+	conn := mocks.NewMockConnection(t)
+	req := NewRawRequest(context.Background(), wasabi.MsgTypeText, []byte("test data"))
+
+	retained := RetainRequest(conn, req)
+	retained.Release()
+
+	if string(retained.Data()) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", retained.Data())
+	}
+}
+
+func TestCopyRequest(t *testing.T) {
+	data := []byte("test data")
+	req := NewRawRequest(context.Background(), wasabi.MsgTypeBinary, data)
+
+	copied := CopyRequest(req)
+
+	data[0] = 'X'
+
+	if string(copied.Data()) != "test data" {
+		t.Errorf("Expected copied data to be '%s', but got '%s'", "test data", copied.Data())
+	}
+
+	if copied.RoutingKey() != "binary" {
+		t.Errorf("Expected routing key to be binary, but got %s", copied.RoutingKey())
+	}
+
+	ctx := context.WithValue(context.Background(), struct{}{}, "value")
+	withCtx := copied.WithContext(ctx)
+
+	if withCtx.Context() != ctx || string(withCtx.Data()) != "test data" {
+		t.Error("Expected request with new context to keep the copied data")
+	}
+}
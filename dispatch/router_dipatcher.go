@@ -45,15 +45,7 @@ func (d *RouterDispatcher) AddBackend(backend wasabi.RequestHandler, routingKeys
 // determining the appropriate backend, and handling the request using middleware.
 // If an error occurs during handling, it is logged.
 func (d *RouterDispatcher) Dispatch(conn wasabi.Connection, msgType wasabi.MessageType, data []byte) {
-	defer func() {
-		if r := recover(); r != nil {
-			slog.Error(
-				"Panic during request handling",
-				slog.Any("error", r),
-				slog.String("stack", string(debug.Stack())),
-			)
-		}
-	}()
+	defer logPanic()
 
 	req := d.parser(conn, conn.Context(), msgType, data)
 
@@ -61,6 +53,11 @@ func (d *RouterDispatcher) Dispatch(conn wasabi.Connection, msgType wasabi.Messa
 		return
 	}
 
+	d.handle(conn, req)
+}
+
+// handle routes the request to the backend and handles it using middleware.
+func (d *RouterDispatcher) handle(conn wasabi.Connection, req wasabi.Request) {
 	backend, ok := d.backendMap[req.RoutingKey()]
 	if !ok {
 		backend = d.defaultBackend
@@ -88,3 +85,14 @@ func (d *RouterDispatcher) useMiddleware(endpoint wasabi.RequestHandler) wasabi.
 
 	return endpoint
 }
+
+// logPanic recovers from panic during request handling and logs it.
+func logPanic() {
+	if r := recover(); r != nil {
+		slog.Error(
+			"Panic during request handling",
+			slog.Any("error", r),
+			slog.String("stack", string(debug.Stack())),
+		)
+	}
+}
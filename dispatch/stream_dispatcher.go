@@ -0,0 +1,46 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// StreamRouterDispatcher is a router dispatcher that receives incoming messages as streams,
+// so large messages can be passed to backends without buffering them in memory.
+// It supports the same backends and middlewares as RouterDispatcher.
+type StreamRouterDispatcher struct {
+	*RouterDispatcher
+	streamParser StreamRequestParser
+}
+
+// NewStreamRouterDispatcher creates a new instance of StreamRouterDispatcher.
+// The defaultBackend parameter is the default backend to be used when no specific backend is found.
+// The parser parameter is used to parse incoming requests from the message stream.
+func NewStreamRouterDispatcher(defaultBackend wasabi.RequestHandler, parser StreamRequestParser) *StreamRouterDispatcher {
+	bufferedParser := func(conn wasabi.Connection, ctx context.Context, msgType wasabi.MessageType, data []byte) wasabi.Request {
+		return parser(conn, ctx, msgType, bytes.NewReader(data))
+	}
+
+	return &StreamRouterDispatcher{
+		RouterDispatcher: NewRouterDispatcher(defaultBackend, bufferedParser),
+		streamParser:     parser,
+	}
+}
+
+// DispatchStream handles the incoming message stream by parsing the request,
+// determining the appropriate backend, and handling the request using middleware.
+// The stream is valid only until the request is handled.
+func (d *StreamRouterDispatcher) DispatchStream(conn wasabi.Connection, msgType wasabi.MessageType, r io.Reader) {
+	defer logPanic()
+
+	req := d.streamParser(conn, conn.Context(), msgType, r)
+
+	if req == nil {
+		return
+	}
+
+	d.handle(conn, req)
+}
@@ -0,0 +1,88 @@
+package dispatch
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamRouterDispatcher_DispatchStream(t *testing.T) {
+	defaultBackend := mocks.NewMockBackend(t)
+	textBackend := mocks.NewMockBackend(t)
+
+	parser := func(_ wasabi.Connection, ctx context.Context, msgType wasabi.MessageType, r io.Reader) wasabi.Request {
+		return NewRawStreamRequest(ctx, msgType, r)
+	}
+
+	dispatcher := NewStreamRouterDispatcher(defaultBackend, parser)
+
+	if err := dispatcher.AddBackend(textBackend, []string{"text"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().Context().Return(context.Background())
+
+	var received string
+
+	textBackend.EXPECT().Handle(conn, mock.Anything).RunAndReturn(func(_ wasabi.Connection, req wasabi.Request) error {
+		streamReq, ok := req.(wasabi.StreamRequest)
+		if !ok {
+			t.Fatal("Expected stream request")
+		}
+
+		data, err := io.ReadAll(streamReq.Reader())
+		received = string(data)
+
+		return err
+	})
+
+	dispatcher.DispatchStream(conn, wasabi.MsgTypeText, strings.NewReader("streamed data"))
+
+	if received != "streamed data" {
+		t.Errorf("Expected backend to receive %q, but got %q", "streamed data", received)
+	}
+}
+
+func TestStreamRouterDispatcher_Dispatch(t *testing.T) {
+	defaultBackend := mocks.NewMockBackend(t)
+
+	parser := func(_ wasabi.Connection, ctx context.Context, msgType wasabi.MessageType, r io.Reader) wasabi.Request {
+		return NewRawStreamRequest(ctx, msgType, r)
+	}
+
+	dispatcher := NewStreamRouterDispatcher(defaultBackend, parser)
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().Context().Return(context.Background())
+
+	defaultBackend.EXPECT().Handle(conn, mock.Anything).RunAndReturn(func(_ wasabi.Connection, req wasabi.Request) error {
+		if string(req.Data()) != "buffered data" {
+			t.Errorf("Expected request data %q, but got %q", "buffered data", req.Data())
+		}
+
+		return nil
+	})
+
+	dispatcher.Dispatch(conn, wasabi.MsgTypeBinary, []byte("buffered data"))
+}
+
+func TestStreamRouterDispatcher_PanicHandling(t *testing.T) {
+	defaultBackend := mocks.NewMockBackend(t)
+
+	parser := func(_ wasabi.Connection, _ context.Context, _ wasabi.MessageType, _ io.Reader) wasabi.Request {
+		panic("test panic")
+	}
+
+	dispatcher := NewStreamRouterDispatcher(defaultBackend, parser)
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().Context().Return(context.Background())
+
+	dispatcher.DispatchStream(conn, wasabi.MsgTypeText, strings.NewReader(""))
+}
@@ -0,0 +1,73 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// RawStreamRequest is a request with the body that is read from the connection as it arrives.
+type RawStreamRequest struct {
+	ctx     context.Context
+	reader  io.Reader
+	data    []byte
+	msgType wasabi.MessageType
+	read    bool
+}
+
+// NewRawStreamRequest creates new instance of RawStreamRequest
+func NewRawStreamRequest(ctx context.Context, msgType wasabi.MessageType, r io.Reader) *RawStreamRequest {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	return &RawStreamRequest{ctx: ctx, reader: r, msgType: msgType}
+}
+
+// Reader returns reader of the request body.
+// If the body was already read with Data, the reader returns the buffered data.
+func (r *RawStreamRequest) Reader() io.Reader {
+	if r.read {
+		return bytes.NewReader(r.data)
+	}
+
+	return r.reader
+}
+
+// Data reads the rest of the request body into memory and returns it.
+// It's kept for handlers that don't support streaming, the streaming handlers should use Reader instead.
+func (r *RawStreamRequest) Data() []byte {
+	if !r.read {
+		r.data, _ = io.ReadAll(r.reader)
+		r.read = true
+	}
+
+	return r.data
+}
+
+func (r *RawStreamRequest) RoutingKey() string {
+	switch r.msgType {
+	case wasabi.MsgTypeText:
+		return "text"
+	case wasabi.MsgTypeBinary:
+		return "binary"
+	default:
+		panic("unknown message type " + r.msgType.String())
+	}
+}
+
+func (r *RawStreamRequest) Context() context.Context {
+	return r.ctx
+}
+
+func (r *RawStreamRequest) WithContext(ctx context.Context) wasabi.Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	r.ctx = ctx
+
+	return r
+}
@@ -0,0 +1,68 @@
+package dispatch
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ksysoev/wasabi"
+)
+
+func TestRawStreamRequest_Reader(t *testing.T) {
+	req := NewRawStreamRequest(context.Background(), wasabi.MsgTypeBinary, strings.NewReader("test data"))
+
+	data, err := io.ReadAll(req.Reader())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(data) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", data)
+	}
+}
+
+func TestRawStreamRequest_Data(t *testing.T) {
+	req := NewRawStreamRequest(context.Background(), wasabi.MsgTypeText, strings.NewReader("test data"))
+
+	if string(req.Data()) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", req.Data())
+	}
+
+	// Data is buffered, so it can be read again both ways
+	if string(req.Data()) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", req.Data())
+	}
+
+	data, err := io.ReadAll(req.Reader())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if string(data) != "test data" {
+		t.Errorf("Expected data to be '%s', but got '%s'", "test data", data)
+	}
+}
+
+func TestRawStreamRequest_RoutingKey(t *testing.T) {
+	req := NewRawStreamRequest(context.Background(), wasabi.MsgTypeBinary, strings.NewReader(""))
+
+	if req.RoutingKey() != "binary" {
+		t.Errorf("Expected routing key to be binary, but got %v", req.RoutingKey())
+	}
+}
+
+func TestRawStreamRequest_WithContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), struct{}{}, "value")
+	req := NewRawStreamRequest(context.Background(), wasabi.MsgTypeText, strings.NewReader(""))
+
+	newReq := req.WithContext(ctx)
+
+	if newReq.Context() != ctx {
+		t.Errorf("Expected context to be %v, but got %v", ctx, newReq.Context())
+	}
+
+	if newReq != req {
+		t.Error("Expected WithContext to return the same request instance")
+	}
+}
@@ -2,6 +2,7 @@ package wasabi
 
 import (
 	"context"
+	"io"
 	"net/http"
 
 	"github.com/coder/websocket"
@@ -21,20 +22,40 @@ type Request interface {
 	WithContext(ctx context.Context) Request
 }
 
+// StreamRequest is interface for requests with the body that is read from the connection as it arrives
+type StreamRequest interface {
+	Request
+	Reader() io.Reader
+}
+
 // Dispatcher is interface for dispatchers
+// The data passed to Dispatch is valid only until Dispatch returns, see RetainPayload to use it longer.
 type Dispatcher interface {
 	Dispatch(conn Connection, msgType MessageType, data []byte)
 }
 
+// StreamDispatcher is interface for dispatchers that receive incoming messages as streams.
+// The reader is valid only until DispatchStream returns, unread data is discarded after that.
+type StreamDispatcher interface {
+	DispatchStream(conn Connection, msgType MessageType, r io.Reader)
+}
+
 // OnMessage is type for OnMessage callback
 type OnMessage func(conn Connection, msgType MessageType, data []byte)
 
+// OnMessageStream is type for OnMessageStream callback
+type OnMessageStream func(conn Connection, msgType MessageType, r io.Reader)
+
 // Connection is interface for connections
 type Connection interface {
 	Send(msgType MessageType, msg []byte) error
+	Writer(msgType MessageType) (io.WriteCloser, error)
 	Context() context.Context
 	ID() string
+	Attr(key string) (any, bool)
+	SetAttr(key string, value any)
 	Close(status websocket.StatusCode, reason string, closingCtx ...context.Context) error
+	CloseInfo() *CloseInfo
 }
 
 // RequestHandler is interface for request handlers
@@ -49,6 +70,24 @@ type Channel interface {
 	Close(ctx ...context.Context) error
 }
 
+// ServingChannel is interface for channels that accept connections on their own listener
+// instead of serving HTTP requests, e.g. raw TCP or Unix socket channels.
+// The server runs Serve for such channels instead of registering their handlers,
+// Serve returns nil after the channel is closed.
+type ServingChannel interface {
+	Channel
+	Serve(ctx context.Context) error
+}
+
+// MessageBus is interface for message buses that connect nodes of a cluster, e.g. Redis Pub/Sub or NATS.
+// Messages published to a subject are delivered to all subscribers of the subject on all nodes,
+// including the publishing node. Delivery is at most once, messages published while a node is disconnected
+// from the bus may be lost.
+type MessageBus interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+	Subscribe(subject string, handler func(data []byte)) (unsubscribe func(), err error)
+}
+
 // ConnectionRegistry is interface for connection registries
 type ConnectionRegistry interface {
 	HandleConnection(
@@ -57,6 +96,18 @@ type ConnectionRegistry interface {
 		cb OnMessage,
 	)
 	GetConnection(id string) Connection
+	Count() int
+	Range(fn func(conn Connection) bool)
+	Filter(fn func(conn Connection) bool) []Connection
 	Close(ctx ...context.Context) error
 	CanAccept() bool
 }
+
+// StreamConnectionRegistry is interface for connection registries that can pass incoming messages as streams
+type StreamConnectionRegistry interface {
+	HandleStreamConnection(
+		ctx context.Context,
+		ws *websocket.Conn,
+		cb OnMessageStream,
+	)
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// NewAttributesMiddleware returns a middleware function that populates initial connection attributes.
+// The extract function is called for every handshake request, and the returned attributes are added to the request context.
+// Once the WebSocket connection is established, the attributes are copied to the connection
+// and can be read in handlers with wasabi.GetAttr.
+// Attributes set by previous middlewares are preserved unless they are overridden.
+func NewAttributesMiddleware(extract func(r *http.Request) map[string]any) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs := extract(r)
+
+			if len(attrs) > 0 {
+				ctx := wasabi.ContextWithAttrs(r.Context(), attrs)
+				r = r.WithContext(ctx)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
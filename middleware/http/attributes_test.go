@@ -0,0 +1,65 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ksysoev/wasabi"
+)
+
+func TestNewAttributesMiddleware(t *testing.T) {
+	var attrs map[string]any
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attrs = wasabi.AttrsFromContext(r.Context())
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tenant := NewAttributesMiddleware(func(r *http.Request) map[string]any {
+		return map[string]any{"tenant": r.Header.Get("X-Tenant"), "version": "v1"}
+	})
+
+	version := NewAttributesMiddleware(func(r *http.Request) map[string]any {
+		return map[string]any{"version": r.URL.Query().Get("v")}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/?v=v2", http.NoBody)
+	req.Header.Set("X-Tenant", "acme")
+
+	w := httptest.NewRecorder()
+
+	tenant(version(handler)).ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+
+	if attrs["tenant"] != "acme" {
+		t.Errorf("Expected tenant attribute to be acme, but got %v", attrs["tenant"])
+	}
+
+	if attrs["version"] != "v2" {
+		t.Errorf("Expected version attribute to be v2, but got %v", attrs["version"])
+	}
+}
+
+func TestNewAttributesMiddleware_NoAttributes(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attrs := wasabi.AttrsFromContext(r.Context()); attrs != nil {
+			t.Errorf("Expected no attributes in the context, but got %v", attrs)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	middleware := NewAttributesMiddleware(func(_ *http.Request) map[string]any { return nil })
+
+	w := httptest.NewRecorder()
+	middleware(handler).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, w.Code)
+	}
+}
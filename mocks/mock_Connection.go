@@ -6,9 +6,12 @@ package mocks
 
 import (
 	context "context"
+	io "io"
 
 	mock "github.com/stretchr/testify/mock"
 
+	wasabi "github.com/ksysoev/wasabi"
+
 	websocket "github.com/coder/websocket"
 )
 
@@ -25,6 +28,64 @@ func (_m *MockConnection) EXPECT() *MockConnection_Expecter {
 	return &MockConnection_Expecter{mock: &_m.Mock}
 }
 
+// Attr provides a mock function with given fields: key
+func (_m *MockConnection) Attr(key string) (interface{}, bool) {
+	ret := _m.Called(key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Attr")
+	}
+
+	var r0 interface{}
+	var r1 bool
+	if rf, ok := ret.Get(0).(func(string) (interface{}, bool)); ok {
+		return rf(key)
+	}
+	if rf, ok := ret.Get(0).(func(string) interface{}); ok {
+		r0 = rf(key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(interface{})
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) bool); ok {
+		r1 = rf(key)
+	} else {
+		r1 = ret.Get(1).(bool)
+	}
+
+	return r0, r1
+}
+
+// MockConnection_Attr_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Attr'
+type MockConnection_Attr_Call struct {
+	*mock.Call
+}
+
+// Attr is a helper method to define mock.On call
+//   - key string
+func (_e *MockConnection_Expecter) Attr(key interface{}) *MockConnection_Attr_Call {
+	return &MockConnection_Attr_Call{Call: _e.mock.On("Attr", key)}
+}
+
+func (_c *MockConnection_Attr_Call) Run(run func(key string)) *MockConnection_Attr_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *MockConnection_Attr_Call) Return(_a0 interface{}, _a1 bool) *MockConnection_Attr_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockConnection_Attr_Call) RunAndReturn(run func(string) (interface{}, bool)) *MockConnection_Attr_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Close provides a mock function with given fields: status, reason, closingCtx
 func (_m *MockConnection) Close(status websocket.StatusCode, reason string, closingCtx ...context.Context) error {
 	_va := make([]interface{}, len(closingCtx))
@@ -87,6 +148,53 @@ func (_c *MockConnection_Close_Call) RunAndReturn(run func(websocket.StatusCode,
 	return _c
 }
 
+// CloseInfo provides a mock function with given fields:
+func (_m *MockConnection) CloseInfo() *wasabi.CloseInfo {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for CloseInfo")
+	}
+
+	var r0 *wasabi.CloseInfo
+	if rf, ok := ret.Get(0).(func() *wasabi.CloseInfo); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*wasabi.CloseInfo)
+		}
+	}
+
+	return r0
+}
+
+// MockConnection_CloseInfo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CloseInfo'
+type MockConnection_CloseInfo_Call struct {
+	*mock.Call
+}
+
+// CloseInfo is a helper method to define mock.On call
+func (_e *MockConnection_Expecter) CloseInfo() *MockConnection_CloseInfo_Call {
+	return &MockConnection_CloseInfo_Call{Call: _e.mock.On("CloseInfo")}
+}
+
+func (_c *MockConnection_CloseInfo_Call) Run(run func()) *MockConnection_CloseInfo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConnection_CloseInfo_Call) Return(_a0 *wasabi.CloseInfo) *MockConnection_CloseInfo_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConnection_CloseInfo_Call) RunAndReturn(run func() *wasabi.CloseInfo) *MockConnection_CloseInfo_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Context provides a mock function with given fields:
 func (_m *MockConnection) Context() context.Context {
 	ret := _m.Called()
@@ -226,6 +334,98 @@ func (_c *MockConnection_Send_Call) RunAndReturn(run func(websocket.MessageType,
 	return _c
 }
 
+// SetAttr provides a mock function with given fields: key, value
+func (_m *MockConnection) SetAttr(key string, value interface{}) {
+	_m.Called(key, value)
+}
+
+// MockConnection_SetAttr_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetAttr'
+type MockConnection_SetAttr_Call struct {
+	*mock.Call
+}
+
+// SetAttr is a helper method to define mock.On call
+//   - key string
+//   - value interface{}
+func (_e *MockConnection_Expecter) SetAttr(key interface{}, value interface{}) *MockConnection_SetAttr_Call {
+	return &MockConnection_SetAttr_Call{Call: _e.mock.On("SetAttr", key, value)}
+}
+
+func (_c *MockConnection_SetAttr_Call) Run(run func(key string, value interface{})) *MockConnection_SetAttr_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(interface{}))
+	})
+	return _c
+}
+
+func (_c *MockConnection_SetAttr_Call) Return() *MockConnection_SetAttr_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockConnection_SetAttr_Call) RunAndReturn(run func(string, interface{})) *MockConnection_SetAttr_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Writer provides a mock function with given fields: msgType
+func (_m *MockConnection) Writer(msgType websocket.MessageType) (io.WriteCloser, error) {
+	ret := _m.Called(msgType)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Writer")
+	}
+
+	var r0 io.WriteCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(websocket.MessageType) (io.WriteCloser, error)); ok {
+		return rf(msgType)
+	}
+	if rf, ok := ret.Get(0).(func(websocket.MessageType) io.WriteCloser); ok {
+		r0 = rf(msgType)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.WriteCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(websocket.MessageType) error); ok {
+		r1 = rf(msgType)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockConnection_Writer_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Writer'
+type MockConnection_Writer_Call struct {
+	*mock.Call
+}
+
+// Writer is a helper method to define mock.On call
+//   - msgType websocket.MessageType
+func (_e *MockConnection_Expecter) Writer(msgType interface{}) *MockConnection_Writer_Call {
+	return &MockConnection_Writer_Call{Call: _e.mock.On("Writer", msgType)}
+}
+
+func (_c *MockConnection_Writer_Call) Run(run func(msgType websocket.MessageType)) *MockConnection_Writer_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(websocket.MessageType))
+	})
+	return _c
+}
+
+func (_c *MockConnection_Writer_Call) Return(_a0 io.WriteCloser, _a1 error) *MockConnection_Writer_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockConnection_Writer_Call) RunAndReturn(run func(websocket.MessageType) (io.WriteCloser, error)) *MockConnection_Writer_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockConnection creates a new instance of MockConnection. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockConnection(t interface {
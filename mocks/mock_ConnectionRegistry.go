@@ -130,6 +130,99 @@ func (_c *MockConnectionRegistry_Close_Call) RunAndReturn(run func(...context.Co
 	return _c
 }
 
+// Count provides a mock function with given fields:
+func (_m *MockConnectionRegistry) Count() int {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Count")
+	}
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func() int); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	return r0
+}
+
+// MockConnectionRegistry_Count_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Count'
+type MockConnectionRegistry_Count_Call struct {
+	*mock.Call
+}
+
+// Count is a helper method to define mock.On call
+func (_e *MockConnectionRegistry_Expecter) Count() *MockConnectionRegistry_Count_Call {
+	return &MockConnectionRegistry_Count_Call{Call: _e.mock.On("Count")}
+}
+
+func (_c *MockConnectionRegistry_Count_Call) Run(run func()) *MockConnectionRegistry_Count_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Count_Call) Return(_a0 int) *MockConnectionRegistry_Count_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Count_Call) RunAndReturn(run func() int) *MockConnectionRegistry_Count_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Filter provides a mock function with given fields: fn
+func (_m *MockConnectionRegistry) Filter(fn func(wasabi.Connection) bool) []wasabi.Connection {
+	ret := _m.Called(fn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Filter")
+	}
+
+	var r0 []wasabi.Connection
+	if rf, ok := ret.Get(0).(func(func(wasabi.Connection) bool) []wasabi.Connection); ok {
+		r0 = rf(fn)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]wasabi.Connection)
+		}
+	}
+
+	return r0
+}
+
+// MockConnectionRegistry_Filter_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Filter'
+type MockConnectionRegistry_Filter_Call struct {
+	*mock.Call
+}
+
+// Filter is a helper method to define mock.On call
+//   - fn func(wasabi.Connection) bool
+func (_e *MockConnectionRegistry_Expecter) Filter(fn interface{}) *MockConnectionRegistry_Filter_Call {
+	return &MockConnectionRegistry_Filter_Call{Call: _e.mock.On("Filter", fn)}
+}
+
+func (_c *MockConnectionRegistry_Filter_Call) Run(run func(fn func(wasabi.Connection) bool)) *MockConnectionRegistry_Filter_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(func(wasabi.Connection) bool))
+	})
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Filter_Call) Return(_a0 []wasabi.Connection) *MockConnectionRegistry_Filter_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Filter_Call) RunAndReturn(run func(func(wasabi.Connection) bool) []wasabi.Connection) *MockConnectionRegistry_Filter_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetConnection provides a mock function with given fields: id
 func (_m *MockConnectionRegistry) GetConnection(id string) wasabi.Connection {
 	ret := _m.Called(id)
@@ -213,6 +306,39 @@ func (_c *MockConnectionRegistry_HandleConnection_Call) RunAndReturn(run func(co
 	return _c
 }
 
+// Range provides a mock function with given fields: fn
+func (_m *MockConnectionRegistry) Range(fn func(wasabi.Connection) bool) {
+	_m.Called(fn)
+}
+
+// MockConnectionRegistry_Range_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Range'
+type MockConnectionRegistry_Range_Call struct {
+	*mock.Call
+}
+
+// Range is a helper method to define mock.On call
+//   - fn func(wasabi.Connection) bool
+func (_e *MockConnectionRegistry_Expecter) Range(fn interface{}) *MockConnectionRegistry_Range_Call {
+	return &MockConnectionRegistry_Range_Call{Call: _e.mock.On("Range", fn)}
+}
+
+func (_c *MockConnectionRegistry_Range_Call) Run(run func(fn func(wasabi.Connection) bool)) *MockConnectionRegistry_Range_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(func(wasabi.Connection) bool))
+	})
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Range_Call) Return() *MockConnectionRegistry_Range_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockConnectionRegistry_Range_Call) RunAndReturn(run func(func(wasabi.Connection) bool)) *MockConnectionRegistry_Range_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // NewMockConnectionRegistry creates a new instance of MockConnectionRegistry. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMockConnectionRegistry(t interface {
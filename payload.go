@@ -0,0 +1,28 @@
+package wasabi
+
+// PayloadRetainer is implemented by connections that lend message payloads from a buffer pool.
+// The payload passed to the OnMessage callback is valid only until the callback returns,
+// RetainPayload extends its lifetime until the returned release function is called.
+type PayloadRetainer interface {
+	RetainPayload(data []byte) (release func())
+}
+
+// ReleasableRequest is interface for requests with the payload borrowed from the connection.
+// The payload stays valid until Release is called, after that it must not be used anymore.
+type ReleasableRequest interface {
+	Request
+	Release()
+}
+
+// RetainPayload keeps the message payload valid after the OnMessage callback returns,
+// e.g. when it's processed asynchronously. The release function must be called when the payload is not used anymore,
+// until then the buffer of the payload is not returned to the pool. Calling release more than once is a no-op.
+// data must be the payload passed to the callback, not a part of it.
+// If the connection doesn't lend payloads from a pool, the payload is already owned by the caller and release does nothing.
+func RetainPayload(conn Connection, data []byte) (release func()) {
+	if retainer, ok := conn.(PayloadRetainer); ok {
+		return retainer.RetainPayload(data)
+	}
+
+	return func() {}
+}
@@ -0,0 +1,118 @@
+package presence
+
+import (
+	"context"
+	"sync"
+)
+
+// Store keeps connections of identities per group.
+// Presence is shared across nodes of a cluster when all nodes use the same store, e.g. backed by Redis,
+// so the store must decide atomically whether a connection is the first or the last one of the identity in the group.
+type Store interface {
+	// Add adds the connection of the identity to the group.
+	// It returns true if it's the first connection of the identity in the group,
+	// adding the connection that is already in the group is a no-op and returns false.
+	Add(ctx context.Context, group, identity, connID string) (bool, error)
+	// Remove removes the connection of the identity from the group.
+	// It returns true if it was the last connection of the identity in the group,
+	// removing the connection that is not in the group is a no-op and returns false.
+	Remove(ctx context.Context, group, identity, connID string) (bool, error)
+	// Online returns identities with connections in the group and numbers of their connections.
+	Online(ctx context.Context, group string) (map[string]int, error)
+	// Connections returns number of connections of the identity in the group.
+	Connections(ctx context.Context, group, identity string) (int, error)
+}
+
+// MemoryStore is in-memory implementation of Store, it keeps presence of a single node.
+type MemoryStore struct {
+	groups map[string]map[string]map[string]struct{}
+	mu     sync.RWMutex
+}
+
+// NewMemoryStore creates new instance of MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		groups: make(map[string]map[string]map[string]struct{}),
+	}
+}
+
+// Add adds the connection of the identity to the group.
+// It returns true if it's the first connection of the identity in the group.
+func (s *MemoryStore) Add(_ context.Context, group, identity, connID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identities, ok := s.groups[group]
+	if !ok {
+		identities = make(map[string]map[string]struct{})
+		s.groups[group] = identities
+	}
+
+	conns, ok := identities[identity]
+	if !ok {
+		conns = make(map[string]struct{})
+		identities[identity] = conns
+	}
+
+	if _, ok := conns[connID]; ok {
+		return false, nil
+	}
+
+	conns[connID] = struct{}{}
+
+	return len(conns) == 1, nil
+}
+
+// Remove removes the connection of the identity from the group.
+// It returns true if it was the last connection of the identity in the group.
+func (s *MemoryStore) Remove(_ context.Context, group, identity, connID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identities := s.groups[group]
+
+	conns, ok := identities[identity]
+	if !ok {
+		return false, nil
+	}
+
+	if _, ok := conns[connID]; !ok {
+		return false, nil
+	}
+
+	delete(conns, connID)
+
+	if len(conns) > 0 {
+		return false, nil
+	}
+
+	delete(identities, identity)
+
+	if len(identities) == 0 {
+		delete(s.groups, group)
+	}
+
+	return true, nil
+}
+
+// Online returns identities with connections in the group and numbers of their connections.
+func (s *MemoryStore) Online(_ context.Context, group string) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	online := make(map[string]int, len(s.groups[group]))
+
+	for identity, conns := range s.groups[group] {
+		online[identity] = len(conns)
+	}
+
+	return online, nil
+}
+
+// Connections returns number of connections of the identity in the group.
+func (s *MemoryStore) Connections(_ context.Context, group, identity string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.groups[group][identity]), nil
+}
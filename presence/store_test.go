@@ -0,0 +1,62 @@
+package presence
+
+import (
+	"context"
+	"maps"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	steps := []struct {
+		op       func() (bool, error)
+		name     string
+		expected bool
+	}{
+		{name: "first connection", op: func() (bool, error) { return store.Add(ctx, "room", "alice", "conn1") }, expected: true},
+		{name: "second connection", op: func() (bool, error) { return store.Add(ctx, "room", "alice", "conn2") }, expected: false},
+		{name: "repeated add", op: func() (bool, error) { return store.Add(ctx, "room", "alice", "conn2") }, expected: false},
+		{name: "other identity", op: func() (bool, error) { return store.Add(ctx, "room", "bob", "conn3") }, expected: true},
+		{name: "not last connection", op: func() (bool, error) { return store.Remove(ctx, "room", "alice", "conn1") }, expected: false},
+		{name: "unknown connection", op: func() (bool, error) { return store.Remove(ctx, "room", "alice", "conn1") }, expected: false},
+		{name: "unknown group", op: func() (bool, error) { return store.Remove(ctx, "lobby", "alice", "conn2") }, expected: false},
+	}
+
+	for _, step := range steps {
+		got, err := step.op()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+
+		if got != step.expected {
+			t.Errorf("%s: got %t, expected %t", step.name, got, step.expected)
+		}
+	}
+
+	online, err := store.Online(ctx, "room")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if expected := map[string]int{"alice": 1, "bob": 1}; !maps.Equal(online, expected) {
+		t.Errorf("Unexpected online identities: got %v, expected %v", online, expected)
+	}
+
+	if last, _ := store.Remove(ctx, "room", "alice", "conn2"); !last {
+		t.Error("Expected the last connection of the identity to be removed")
+	}
+
+	if n, _ := store.Connections(ctx, "room", "alice"); n != 0 {
+		t.Errorf("Unexpected number of connections: got %d, expected %d", n, 0)
+	}
+
+	if last, _ := store.Remove(ctx, "room", "bob", "conn3"); !last {
+		t.Error("Expected the last connection of the identity to be removed")
+	}
+
+	if len(store.groups) != 0 {
+		t.Errorf("Expected empty groups to be removed, but got %v", store.groups)
+	}
+}
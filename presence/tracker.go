@@ -0,0 +1,414 @@
+// Package presence tracks identities, e.g. users, that are online across their connections.
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ksysoev/wasabi"
+)
+
+// GlobalGroup is the group of all tracked identities, connections are added to it if groups are not configured.
+const GlobalGroup = "global"
+
+// ErrNotTracked is error for connections that are not tracked, e.g. connections without identity.
+var ErrNotTracked = errors.New("connection is not tracked")
+
+// EventType is type of presence events.
+type EventType int
+
+const (
+	// EventJoin is emitted when the first connection of the identity is added to the group.
+	EventJoin EventType = iota
+	// EventLeave is emitted when the last connection of the identity is removed from the group.
+	EventLeave
+)
+
+// String returns name of the event type.
+func (t EventType) String() string {
+	if t == EventLeave {
+		return "leave"
+	}
+
+	return "join"
+}
+
+// Event is a change of presence of the identity in the group.
+type Event struct {
+	// Group is the group the identity joined or left.
+	Group string
+	// Identity is the identity that joined or left the group.
+	Identity string
+	// ConnectionID is id of the connection that caused the event.
+	ConnectionID string
+	// Type is the type of the event.
+	Type EventType
+}
+
+// EventHandler is called for presence events.
+type EventHandler func(event Event)
+
+// IdentityFunc returns identity of the connection, connections with empty identity are not tracked.
+type IdentityFunc func(conn wasabi.Connection) string
+
+// GroupsFunc returns groups the connection is added to when it's connected.
+type GroupsFunc func(conn wasabi.Connection) []string
+
+// IdentityFromAttr returns IdentityFunc that takes identity from the string connection attribute with the given key.
+func IdentityFromAttr(key string) IdentityFunc {
+	return func(conn wasabi.Connection) string {
+		identity, _ := wasabi.GetAttr[string](conn, key)
+		return identity
+	}
+}
+
+// GroupsFromAttr returns GroupsFunc that takes groups from the connection attribute with the given key,
+// the attribute can be a string or a slice of strings.
+func GroupsFromAttr(key string) GroupsFunc {
+	return func(conn wasabi.Connection) []string {
+		value, ok := conn.Attr(key)
+		if !ok {
+			return nil
+		}
+
+		switch groups := value.(type) {
+		case string:
+			return []string{groups}
+		case []string:
+			return groups
+		default:
+			return nil
+		}
+	}
+}
+
+// Tracker tracks presence of identities in groups.
+// It's attached to the connection registry with its OnConnect and OnDisconnect hooks,
+// the identity and groups of the connection are taken when it's connected.
+// Connections can join and leave other groups later, e.g. chat rooms, with Join and Leave.
+type Tracker struct {
+	store    Store
+	identity IdentityFunc
+	groups   GroupsFunc
+	onEvent  EventHandler
+	conns    map[string]*trackedConn
+	pending  map[string]*pendingRemoval
+	debounce time.Duration
+	mu       sync.Mutex
+	closed   bool
+}
+
+// trackedConn is the presence of the connection.
+type trackedConn struct {
+	groups   map[string]struct{}
+	identity string
+}
+
+// pendingRemoval is the presence of the closed connection that is removed after the debounce delay.
+type pendingRemoval struct {
+	conn  *trackedConn
+	timer *time.Timer
+}
+
+// Option is a function that configures the Tracker.
+type Option func(*Tracker)
+
+// NewTracker creates new instance of Tracker with the store and the function that returns identities of connections.
+func NewTracker(store Store, identity IdentityFunc, opts ...Option) *Tracker {
+	t := &Tracker{
+		store:    store,
+		identity: identity,
+		groups:   func(wasabi.Connection) []string { return []string{GlobalGroup} },
+		conns:    make(map[string]*trackedConn),
+		pending:  make(map[string]*pendingRemoval),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// OnConnect adds the connection to its groups, it can be used as the connect hook of the connection registry.
+// If the connection resumes a session that is still within the debounce delay, its pending removal is canceled.
+func (t *Tracker) OnConnect(conn wasabi.Connection) {
+	identity := t.identity(conn)
+	if identity == "" {
+		return
+	}
+
+	id := conn.ID()
+	tracked := &trackedConn{
+		identity: identity,
+		groups:   make(map[string]struct{}),
+	}
+
+	for _, group := range t.groups(conn) {
+		tracked.groups[group] = struct{}{}
+	}
+
+	t.mu.Lock()
+
+	var prev *trackedConn
+	if p, ok := t.pending[id]; ok {
+		p.timer.Stop()
+		delete(t.pending, id)
+
+		prev = p.conn
+	}
+
+	t.conns[id] = tracked
+	t.mu.Unlock()
+
+	ctx := context.Background()
+
+	if prev != nil {
+		for group := range prev.groups {
+			if _, ok := tracked.groups[group]; !ok || prev.identity != identity {
+				t.logError(t.remove(ctx, group, prev.identity, id))
+			}
+		}
+	}
+
+	for group := range tracked.groups {
+		t.logError(t.add(ctx, group, identity, id))
+	}
+}
+
+// OnDisconnect removes the connection from its groups, it can be used as the disconnect hook of the connection registry.
+// If the debounce delay is set, the connection is removed after the delay,
+// so identities that reconnect within the delay don't leave and join again.
+func (t *Tracker) OnDisconnect(conn wasabi.Connection, _ *wasabi.CloseInfo) {
+	id := conn.ID()
+
+	t.mu.Lock()
+
+	tracked, ok := t.conns[id]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	delete(t.conns, id)
+
+	if t.debounce <= 0 || t.closed {
+		t.mu.Unlock()
+		t.removeAll(id, tracked)
+
+		return
+	}
+
+	p := &pendingRemoval{conn: tracked}
+	p.timer = time.AfterFunc(t.debounce, func() { t.expire(id, p) })
+	t.pending[id] = p
+
+	t.mu.Unlock()
+}
+
+// Join adds the tracked connection to the group.
+// It returns ErrNotTracked if the connection is not tracked.
+func (t *Tracker) Join(ctx context.Context, conn wasabi.Connection, group string) error {
+	id := conn.ID()
+
+	t.mu.Lock()
+
+	tracked, ok := t.conns[id]
+	if !ok {
+		t.mu.Unlock()
+		return ErrNotTracked
+	}
+
+	if _, ok := tracked.groups[group]; ok {
+		t.mu.Unlock()
+		return nil
+	}
+
+	tracked.groups[group] = struct{}{}
+	t.mu.Unlock()
+
+	if err := t.add(ctx, group, tracked.identity, id); err != nil {
+		return err
+	}
+
+	// The connection could be removed from the group while it was being added to the store,
+	// in this case the removal could have run before the add, so the add is undone.
+	t.mu.Lock()
+	_, inGroup := tracked.groups[group]
+	current := inGroup && t.isCurrent(id, tracked)
+	t.mu.Unlock()
+
+	if !current {
+		return t.remove(ctx, group, tracked.identity, id)
+	}
+
+	return nil
+}
+
+// isCurrent reports whether the presence of the connection is still tracked,
+// connections within the debounce delay are tracked until their removal.
+// It must be called with the lock held.
+func (t *Tracker) isCurrent(id string, tracked *trackedConn) bool {
+	if t.conns[id] == tracked {
+		return true
+	}
+
+	p, ok := t.pending[id]
+
+	return ok && p.conn == tracked
+}
+
+// Leave removes the tracked connection from the group immediately, the debounce delay doesn't apply.
+// It returns ErrNotTracked if the connection is not tracked.
+func (t *Tracker) Leave(ctx context.Context, conn wasabi.Connection, group string) error {
+	id := conn.ID()
+
+	t.mu.Lock()
+
+	tracked, ok := t.conns[id]
+	if !ok {
+		t.mu.Unlock()
+		return ErrNotTracked
+	}
+
+	if _, ok := tracked.groups[group]; !ok {
+		t.mu.Unlock()
+		return nil
+	}
+
+	delete(tracked.groups, group)
+	t.mu.Unlock()
+
+	return t.remove(ctx, group, tracked.identity, id)
+}
+
+// Online returns identities that are online in the group and numbers of their connections.
+// Connections within the debounce delay after they were closed are counted as online.
+func (t *Tracker) Online(ctx context.Context, group string) (map[string]int, error) {
+	return t.store.Online(ctx, group)
+}
+
+// IsOnline reports whether the identity has connections in the group.
+func (t *Tracker) IsOnline(ctx context.Context, group, identity string) (bool, error) {
+	n, err := t.store.Connections(ctx, group, identity)
+
+	return n > 0, err
+}
+
+// Connections returns number of connections of the identity in the group.
+func (t *Tracker) Connections(ctx context.Context, group, identity string) (int, error) {
+	return t.store.Connections(ctx, group, identity)
+}
+
+// Close removes connections that are waiting for the debounce delay right away,
+// connections closed after that are removed without delay.
+// It should be called after the connection registry is closed, so presence of the node doesn't linger in shared store.
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	t.closed = true
+	pending := t.pending
+	t.pending = make(map[string]*pendingRemoval)
+	t.mu.Unlock()
+
+	for id, p := range pending {
+		p.timer.Stop()
+		t.removeAll(id, p.conn)
+	}
+}
+
+// expire removes the connection after the debounce delay, unless the removal was canceled or already done.
+func (t *Tracker) expire(id string, p *pendingRemoval) {
+	t.mu.Lock()
+
+	if t.pending[id] != p {
+		t.mu.Unlock()
+		return
+	}
+
+	delete(t.pending, id)
+	t.mu.Unlock()
+
+	t.removeAll(id, p.conn)
+}
+
+// removeAll removes the connection from all its groups.
+func (t *Tracker) removeAll(id string, tracked *trackedConn) {
+	ctx := context.Background()
+
+	for group := range tracked.groups {
+		t.logError(t.remove(ctx, group, tracked.identity, id))
+	}
+}
+
+// add adds the connection to the group in the store and emits join event if it's the first connection of the identity.
+func (t *Tracker) add(ctx context.Context, group, identity, id string) error {
+	first, err := t.store.Add(ctx, group, identity, id)
+	if err != nil {
+		return fmt.Errorf("failed to add connection %s to presence group %s: %w", id, group, err)
+	}
+
+	if first {
+		t.emit(Event{Type: EventJoin, Group: group, Identity: identity, ConnectionID: id})
+	}
+
+	return nil
+}
+
+// remove removes the connection from the group in the store and emits leave event if it was the last connection of the identity.
+func (t *Tracker) remove(ctx context.Context, group, identity, id string) error {
+	last, err := t.store.Remove(ctx, group, identity, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove connection %s from presence group %s: %w", id, group, err)
+	}
+
+	if last {
+		t.emit(Event{Type: EventLeave, Group: group, Identity: identity, ConnectionID: id})
+	}
+
+	return nil
+}
+
+// emit calls the event handler if it's set.
+func (t *Tracker) emit(event Event) {
+	if t.onEvent != nil {
+		t.onEvent(event)
+	}
+}
+
+// logError logs errors of presence updates made by hooks, that have no caller to return them to.
+func (t *Tracker) logError(err error) {
+	if err != nil {
+		slog.Error("Failed to update presence: " + err.Error())
+	}
+}
+
+// WithGroups sets the function that returns groups the connection is added to when it's connected.
+// By default, connections are added to GlobalGroup. See GroupsFromAttr.
+func WithGroups(groups GroupsFunc) Option {
+	return func(t *Tracker) {
+		t.groups = groups
+	}
+}
+
+// WithDebounce sets the delay before closed connections are removed from their groups.
+// If the identity reconnects within the delay, e.g. after a network flap or a page reload,
+// neither leave nor join events are emitted. Closed connections are counted as online during the delay.
+// The delay is disabled by default.
+func WithDebounce(delay time.Duration) Option {
+	return func(t *Tracker) {
+		t.debounce = delay
+	}
+}
+
+// WithOnEvent sets the handler that is called when the identity joins or leaves a group.
+// With a shared store, the event is emitted only on the node where the first connection was added
+// or the last connection was removed, use the cluster mode of the registry to publish it to other nodes.
+func WithOnEvent(handler EventHandler) Option {
+	return func(t *Tracker) {
+		t.onEvent = handler
+	}
+}
@@ -0,0 +1,319 @@
+package presence
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ksysoev/wasabi"
+	"github.com/ksysoev/wasabi/mocks"
+	"github.com/stretchr/testify/mock"
+)
+
+// presenceConn returns mock connection with the given id and attributes.
+func presenceConn(t *testing.T, id string, attrs map[string]any) *mocks.MockConnection {
+	t.Helper()
+
+	conn := mocks.NewMockConnection(t)
+	conn.EXPECT().ID().Return(id).Maybe()
+	conn.EXPECT().Attr(mock.Anything).RunAndReturn(func(key string) (any, bool) {
+		value, ok := attrs[key]
+		return value, ok
+	}).Maybe()
+
+	return conn
+}
+
+// eventRecorder records presence events, events can be emitted from timer goroutines.
+type eventRecorder struct {
+	events []Event
+	mu     sync.Mutex
+}
+
+func (r *eventRecorder) handle(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) get() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.events)
+}
+
+func TestTracker_Events(t *testing.T) {
+	ctx := context.Background()
+	events := &eventRecorder{}
+	tracker := NewTracker(NewMemoryStore(), IdentityFromAttr("user"), WithOnEvent(events.handle))
+
+	phone := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+	laptop := presenceConn(t, "conn2", map[string]any{"user": "alice"})
+	bob := presenceConn(t, "conn3", map[string]any{"user": "bob"})
+	anonymous := presenceConn(t, "conn4", nil)
+
+	for _, conn := range []wasabi.Connection{phone, laptop, bob, anonymous} {
+		tracker.OnConnect(conn)
+	}
+
+	online, err := tracker.Online(ctx, GlobalGroup)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if expected := map[string]int{"alice": 2, "bob": 1}; !maps.Equal(online, expected) {
+		t.Errorf("Unexpected online identities: got %v, expected %v", online, expected)
+	}
+
+	tracker.OnDisconnect(phone, nil)
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "alice"); !isOnline {
+		t.Error("Expected alice to be online on the other device")
+	}
+
+	tracker.OnDisconnect(laptop, nil)
+	tracker.OnDisconnect(anonymous, nil)
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "alice"); isOnline {
+		t.Error("Expected alice to be offline")
+	}
+
+	expected := []Event{
+		{Type: EventJoin, Group: GlobalGroup, Identity: "alice", ConnectionID: "conn1"},
+		{Type: EventJoin, Group: GlobalGroup, Identity: "bob", ConnectionID: "conn3"},
+		{Type: EventLeave, Group: GlobalGroup, Identity: "alice", ConnectionID: "conn2"},
+	}
+
+	if got := events.get(); !slices.Equal(got, expected) {
+		t.Errorf("Unexpected events: got %v, expected %v", got, expected)
+	}
+}
+
+func TestTracker_Debounce(t *testing.T) {
+	ctx := context.Background()
+	events := &eventRecorder{}
+	tracker := NewTracker(NewMemoryStore(), IdentityFromAttr("user"),
+		WithOnEvent(events.handle),
+		WithDebounce(50*time.Millisecond),
+	)
+
+	first := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+	reconnected := presenceConn(t, "conn2", map[string]any{"user": "alice"})
+
+	tracker.OnConnect(first)
+	tracker.OnDisconnect(first, nil)
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "alice"); !isOnline {
+		t.Error("Expected alice to stay online within the debounce delay")
+	}
+
+	tracker.OnConnect(reconnected)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n, _ := tracker.Connections(ctx, GlobalGroup, "alice"); n != 1 {
+		t.Errorf("Unexpected number of connections after the debounce delay: got %d, expected %d", n, 1)
+	}
+
+	if got := events.get(); len(got) != 1 || got[0].Type != EventJoin {
+		t.Errorf("Expected only the first join event for the flapping connection, but got %v", got)
+	}
+
+	tracker.OnDisconnect(reconnected, nil)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if got := events.get(); len(got) != 2 || got[1].Type != EventLeave {
+		t.Errorf("Expected leave event after the debounce delay, but got %v", got)
+	}
+}
+
+func TestTracker_ResumedConnection(t *testing.T) {
+	ctx := context.Background()
+	events := &eventRecorder{}
+	tracker := NewTracker(NewMemoryStore(), IdentityFromAttr("user"),
+		WithOnEvent(events.handle),
+		WithDebounce(50*time.Millisecond),
+		WithGroups(GroupsFromAttr("rooms")),
+	)
+
+	// Resumed sessions keep the connection id, the resumed connection can have different groups.
+	conn := presenceConn(t, "conn1", map[string]any{"user": "alice", "rooms": []string{"general", "random"}})
+	resumed := presenceConn(t, "conn1", map[string]any{"user": "alice", "rooms": "general"})
+
+	tracker.OnConnect(conn)
+	tracker.OnDisconnect(conn, nil)
+	tracker.OnConnect(resumed)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n, _ := tracker.Connections(ctx, "general", "alice"); n != 1 {
+		t.Errorf("Expected resumed connection to stay in the group, but got %d connections", n)
+	}
+
+	if isOnline, _ := tracker.IsOnline(ctx, "random", "alice"); isOnline {
+		t.Error("Expected resumed connection to leave the group it's not in anymore")
+	}
+
+	got := events.get()
+	if len(got) != 3 || got[2] != (Event{Type: EventLeave, Group: "random", Identity: "alice", ConnectionID: "conn1"}) {
+		t.Errorf("Unexpected events: %v", got)
+	}
+}
+
+func TestTracker_JoinLeave(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTracker(NewMemoryStore(), IdentityFromAttr("user"), WithGroups(func(wasabi.Connection) []string { return nil }))
+
+	conn := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+	anonymous := presenceConn(t, "conn2", nil)
+
+	tracker.OnConnect(conn)
+	tracker.OnConnect(anonymous)
+
+	if err := tracker.Join(ctx, anonymous, "room"); !errors.Is(err, ErrNotTracked) {
+		t.Errorf("Expected error %v, but got %v", ErrNotTracked, err)
+	}
+
+	if err := tracker.Leave(ctx, anonymous, "room"); !errors.Is(err, ErrNotTracked) {
+		t.Errorf("Expected error %v, but got %v", ErrNotTracked, err)
+	}
+
+	for range 2 {
+		if err := tracker.Join(ctx, conn, "room"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if n, _ := tracker.Connections(ctx, "room", "alice"); n != 1 {
+		t.Errorf("Unexpected number of connections: got %d, expected %d", n, 1)
+	}
+
+	if err := tracker.Leave(ctx, conn, "room"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := tracker.Leave(ctx, conn, "room"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if isOnline, _ := tracker.IsOnline(ctx, "room", "alice"); isOnline {
+		t.Error("Expected alice to leave the room")
+	}
+}
+
+func TestTracker_Close(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTracker(NewMemoryStore(), IdentityFromAttr("user"), WithDebounce(time.Hour))
+
+	pending := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+	open := presenceConn(t, "conn2", map[string]any{"user": "bob"})
+
+	tracker.OnConnect(pending)
+	tracker.OnConnect(open)
+	tracker.OnDisconnect(pending, nil)
+
+	tracker.Close()
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "alice"); isOnline {
+		t.Error("Expected pending connection to be removed on close")
+	}
+
+	tracker.OnDisconnect(open, nil)
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "bob"); isOnline {
+		t.Error("Expected connection closed after the tracker to be removed without delay")
+	}
+}
+
+// failingStore is a store that fails every update.
+type failingStore struct {
+	*MemoryStore
+}
+
+func (failingStore) Add(context.Context, string, string, string) (bool, error) {
+	return false, errors.New("store is down")
+}
+
+func TestTracker_StoreError(t *testing.T) {
+	tracker := NewTracker(failingStore{NewMemoryStore()}, IdentityFromAttr("user"))
+
+	conn := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+
+	tracker.OnConnect(conn)
+
+	if err := tracker.Join(context.Background(), conn, "room"); err == nil {
+		t.Error("Expected store error")
+	}
+}
+
+// slowStore is a store that runs beforeAdd before the connection is added.
+type slowStore struct {
+	*MemoryStore
+	beforeAdd func()
+}
+
+func (s *slowStore) Add(ctx context.Context, group, identity, connID string) (bool, error) {
+	if s.beforeAdd != nil {
+		s.beforeAdd()
+	}
+
+	return s.MemoryStore.Add(ctx, group, identity, connID)
+}
+
+func TestTracker_JoinDisconnected(t *testing.T) {
+	ctx := context.Background()
+	store := &slowStore{MemoryStore: NewMemoryStore()}
+	tracker := NewTracker(store, IdentityFromAttr("user"))
+
+	conn := presenceConn(t, "conn1", map[string]any{"user": "alice"})
+
+	tracker.OnConnect(conn)
+
+	// The connection is closed while it's being added to the room.
+	store.beforeAdd = func() {
+		store.beforeAdd = nil
+		tracker.OnDisconnect(conn, nil)
+	}
+
+	if err := tracker.Join(ctx, conn, "room"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if isOnline, _ := tracker.IsOnline(ctx, "room", "alice"); isOnline {
+		t.Error("Expected disconnected connection not to stay in the room")
+	}
+
+	if isOnline, _ := tracker.IsOnline(ctx, GlobalGroup, "alice"); isOnline {
+		t.Error("Expected disconnected connection to be removed")
+	}
+}
+
+func TestGroupsFromAttr(t *testing.T) {
+	groups := GroupsFromAttr("groups")
+
+	tests := []struct {
+		attrs    map[string]any
+		name     string
+		expected []string
+	}{
+		{name: "string", attrs: map[string]any{"groups": "room"}, expected: []string{"room"}},
+		{name: "slice", attrs: map[string]any{"groups": []string{"a", "b"}}, expected: []string{"a", "b"}},
+		{name: "other type", attrs: map[string]any{"groups": 42}},
+		{name: "not set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groups(presenceConn(t, "conn", tt.attrs)); !slices.Equal(got, tt.expected) {
+				t.Errorf("Unexpected groups: got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -108,6 +108,8 @@ func (s *Server) GetServerConfig() Config {
 }
 
 // AddChannel adds new channel to server
+// Channels that implement wasabi.ServingChannel are served on their own listeners when the server starts,
+// instead of being registered on the HTTP server.
 func (s *Server) AddChannel(channel wasabi.Channel) {
 	s.channels = append(s.channels, channel)
 }
@@ -130,6 +132,11 @@ func (s *Server) Run() (err error) {
 	mux := http.NewServeMux()
 
 	for _, channel := range s.channels {
+		if serving, ok := channel.(wasabi.ServingChannel); ok {
+			go s.serveChannel(serving)
+			continue
+		}
+
 		mux.Handle(
 			channel.Path(),
 			channel.Handler(),
@@ -170,24 +177,23 @@ func (s *Server) Run() (err error) {
 	return nil
 }
 
+// serveChannel runs the channel that accepts connections on its own listener until it's closed.
+func (s *Server) serveChannel(channel wasabi.ServingChannel) {
+	slog.Info("Starting channel on " + channel.Path())
+
+	if err := channel.Serve(s.baseCtx); err != nil {
+		slog.Error("Error serving channel " + channel.Path() + ": " + err.Error())
+	}
+}
+
 // Shutdown gracefully shuts down the server and all its channels.
-// It waits for all channels to be shut down before returning.
+// Channels are closed first, so the server keeps serving HTTP requests while connections are drained,
+// and new connections are rejected by the channels instead of being refused by the closed listener.
+// After that, the HTTP server is shut down with the same context.
+// The deadline of the context limits the drain of the channels as well as the shutdown of the HTTP server.
 // If the context is canceled before all channels are shut down, it returns the context error.
 // If any error occurs during the shutdown process, it returns the first error encountered.
 func (s *Server) Close(ctx ...context.Context) error {
-	done := make(chan error)
-
-	go func() {
-		defer close(done)
-
-		if len(ctx) > 0 {
-			done <- s.handler.Shutdown(ctx[0])
-			return
-		}
-
-		done <- s.handler.Close()
-	}()
-
 	wg := sync.WaitGroup{}
 
 	for _, channel := range s.channels {
@@ -206,7 +212,11 @@ func (s *Server) Close(ctx ...context.Context) error {
 
 	wg.Wait()
 
-	return <-done
+	if len(ctx) > 0 {
+		return s.handler.Shutdown(ctx[0])
+	}
+
+	return s.handler.Close()
 }
 
 // Addr returns the server's network address.
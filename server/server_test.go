@@ -473,3 +473,122 @@ func TestServer_AddHandler(t *testing.T) {
 		t.Errorf("Expected status code %d, but got %d", http.StatusOK, status)
 	}
 }
+
+func TestServer_Close_ServesWhileDraining(t *testing.T) {
+	ready := make(chan struct{})
+	server := NewServer(":0", WithReadinessChan(ready))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	channel := mocks.NewMockChannel(t)
+	channel.EXPECT().Path().Return("/test")
+	channel.EXPECT().Handler().Return(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	// While the channel is draining, the server must still serve requests
+	channel.EXPECT().Close(ctx).RunAndReturn(func(_ ...context.Context) error {
+		resp, err := http.Get("http://" + server.Addr().String() + "/test")
+		if err != nil {
+			t.Errorf("Expected server to serve requests during drain, but got error: %v", err)
+			return nil
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Unexpected status code: got %d, expected %d", resp.StatusCode, http.StatusServiceUnavailable)
+		}
+
+		return nil
+	})
+
+	server.AddChannel(channel)
+
+	done := make(chan struct{})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected server to start")
+	}
+
+	if err := server.Close(ctx); err != nil {
+		t.Errorf("Unexpected error shutting down server: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Error("Expected server to stop")
+	}
+}
+
+// testServingChannel is a channel that accepts connections on its own listener.
+type testServingChannel struct {
+	served chan struct{}
+	closed chan struct{}
+}
+
+func (c *testServingChannel) Path() string { return "127.0.0.1:9000" }
+
+func (c *testServingChannel) Handler() http.Handler {
+	panic("handler of serving channel must not be registered")
+}
+
+func (c *testServingChannel) Serve(_ context.Context) error {
+	close(c.served)
+	<-c.closed
+
+	return nil
+}
+
+func (c *testServingChannel) Close(_ ...context.Context) error {
+	close(c.closed)
+	return nil
+}
+
+func TestServer_Run_ServingChannel(t *testing.T) {
+	ready := make(chan struct{})
+	server := NewServer(":0", WithReadinessChan(ready))
+
+	channel := &testServingChannel{served: make(chan struct{}), closed: make(chan struct{})}
+	server.AddChannel(channel)
+
+	done := make(chan struct{})
+
+	go func() {
+		if err := server.Run(); err != nil {
+			t.Errorf("Got unexpected error: %v", err)
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-channel.served:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected server to serve the channel")
+	}
+
+	<-ready
+
+	if err := server.Close(); err != nil {
+		t.Errorf("Unexpected error shutting down server: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Error("Expected server to stop")
+	}
+}